@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+)
+
+// RegRole is the role of an integer register in the standard calling
+// convention.
+type RegRole int
+
+const (
+	RoleZero RegRole = iota
+	RoleReturnAddress
+	RoleStackPointer
+	RoleGlobalPointer
+	RoleThreadPointer
+	RoleTemporary
+	RoleSaved
+	RoleArgument
+)
+
+// regRoleNames are the names of each role, which are also the names of
+// the variants of the generated Rust RegRole enum.
+var regRoleNames = [...]string{
+	RoleZero:          "Zero",
+	RoleReturnAddress: "ReturnAddress",
+	RoleStackPointer:  "StackPointer",
+	RoleGlobalPointer: "GlobalPointer",
+	RoleThreadPointer: "ThreadPointer",
+	RoleTemporary:     "Temporary",
+	RoleSaved:         "Saved",
+	RoleArgument:      "Argument",
+}
+
+func (r RegRole) String() string {
+	return regRoleNames[r]
+}
+
+// defaultIntABINames are the names of the integer registers in the
+// standard calling convention, which we use when the registers file is
+// absent or doesn't give a recognizable ABI name.
+var defaultIntABINames = [32]string{
+	"zero", "ra", "sp", "gp", "tp", "t0", "t1", "t2",
+	"s0", "s1", "a0", "a1", "a2", "a3", "a4", "a5",
+	"a6", "a7", "s2", "s3", "s4", "s5", "s6", "s7",
+	"s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6",
+}
+
+// IntRegisterRole returns the calling convention role of the integer
+// register with the given number, which must be between 0 and 31.
+func (isa *ISA) IntRegisterRole(num int) RegRole {
+	for _, reg := range isa.Registers {
+		if reg.Type != ArgIntReg || reg.Num != num {
+			continue
+		}
+		if role, ok := roleForABIName(reg.ABIName); ok {
+			return role
+		}
+	}
+	role, _ := roleForABIName(defaultIntABINames[num])
+	return role
+}
+
+func roleForABIName(name string) (RegRole, bool) {
+	switch name {
+	case "zero":
+		return RoleZero, true
+	case "ra":
+		return RoleReturnAddress, true
+	case "sp":
+		return RoleStackPointer, true
+	case "gp":
+		return RoleGlobalPointer, true
+	case "tp":
+		return RoleThreadPointer, true
+	case "fp":
+		return RoleSaved, true
+	}
+	switch {
+	case strings.HasPrefix(name, "t"):
+		return RoleTemporary, true
+	case strings.HasPrefix(name, "s"):
+		return RoleSaved, true
+	case strings.HasPrefix(name, "a"):
+		return RoleArgument, true
+	default:
+		return RoleZero, false
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math/bits"
 	"strconv"
 	"strings"
 )
@@ -16,8 +17,33 @@ const (
 	ArgOffset            ArgType = "offset"
 	ArgSignedImmediate   ArgType = "simm"
 	ArgUnsignedImmediate ArgType = "uimm"
+	ArgOrdering          ArgType = "ord"
 )
 
+// Description returns a short human-readable description of the kind of
+// value that an argument of the type holds, for use in generated
+// documentation.
+func (t ArgType) Description() string {
+	switch t {
+	case ArgIntReg:
+		return "integer register number"
+	case ArgFloatReg:
+		return "floating-point register number"
+	case ArgCompressedReg:
+		return "compressed register number, selecting from register 8 onwards"
+	case ArgOffset:
+		return "signed offset"
+	case ArgSignedImmediate:
+		return "signed immediate"
+	case ArgUnsignedImmediate:
+		return "unsigned immediate"
+	case ArgOrdering:
+		return "memory ordering"
+	default:
+		return "field"
+	}
+}
+
 func rangeMask(top, bottom uint) bits32 {
 	return bits32((1 << (top + 1)) - (1 << bottom))
 }
@@ -38,6 +64,112 @@ func (s ArgDecodeStep) String() string {
 	}
 }
 
+// SourceRange returns the highest and lowest bit positions in the
+// instruction word that the step reads from.
+func (s ArgDecodeStep) SourceRange() (hi, lo int) {
+	return 31 - bits.LeadingZeros32(uint32(s.Mask)), bits.TrailingZeros32(uint32(s.Mask))
+}
+
+// ValueRange returns the highest and lowest bit positions in the
+// argument's value that the step produces.
+func (s ArgDecodeStep) ValueRange() (hi, lo int) {
+	hi, lo = s.SourceRange()
+	return hi - s.RightShift, lo - s.RightShift
+}
+
+// Invert is the inverse of the step, returning the bits of the instruction
+// word that represent the bits of the given value that the step produces.
+func (s ArgDecodeStep) Invert(v bits32) bits32 {
+	if s.RightShift < 0 {
+		return (v >> -s.RightShift) & s.Mask
+	}
+	return (v << s.RightShift) & s.Mask
+}
+
+// Describe returns a short description of which bits of the named argument
+// the step produces, for use in comments in generated code.
+func (s ArgDecodeStep) Describe(argName string) string {
+	hi, lo := s.SourceRange()
+	valHi, valLo := s.ValueRange()
+	if hi == lo {
+		return fmt.Sprintf("Bit %d of the instruction, holding %s[%d].", hi, argName, valHi)
+	}
+	return fmt.Sprintf("Bits %d:%d of the instruction, holding %s[%d:%d].", hi, lo, argName, valHi, valLo)
+}
+
+// ForSize returns the encoding of the argument under the given base ISA
+// size, which is the argument itself unless it has a size-specific
+// encoding for that size.
+func (a *Argument) ForSize(size Size) *Argument {
+	if sized, ok := a.Sizes[size]; ok {
+		return sized
+	}
+	return a
+}
+
+// Mask returns the mask of all of the bits of the instruction word that
+// encode the argument.
+func (a *Argument) Mask() bits32 {
+	var ret bits32
+	for _, step := range a.Decoding {
+		ret |= step.Mask
+	}
+	return ret
+}
+
+// Scale returns the position of the lowest bit of the argument's value that
+// the encoding stores, such as 1 for a branch offset whose lowest bit is
+// always zero. The encoded field holds the value shifted right by this
+// many bits.
+func (a *Argument) Scale() int {
+	scale := -1
+	for _, step := range a.Decoding {
+		_, lo := step.SourceRange()
+		if pos := lo - step.RightShift; scale < 0 || pos < scale {
+			scale = pos
+		}
+	}
+	if scale < 0 {
+		return 0
+	}
+	return scale
+}
+
+// sortedArgEncodings returns all of the distinct encodings of the given
+// arguments, including their size-specific encodings, ordered by name and
+// then by size. Generators use this to produce one accessor for each.
+func sortedArgEncodings(args map[string]*Argument) []*Argument {
+	var ret []*Argument
+	for _, name := range sortedArgNames(args) {
+		arg := args[name]
+		ret = append(ret, arg)
+		for _, size := range []Size{RV32, RV64, RV128} {
+			if sized, ok := arg.Sizes[size]; ok {
+				ret = append(ret, sized)
+			}
+		}
+	}
+	return ret
+}
+
+// MaskConstName returns the name of a constant for the mask of the given
+// decode step of the argument, in the given style of constant naming.
+func (a *Argument) MaskConstName(step int, style NameStyle) string {
+	var suffix string
+	if len(a.Decoding) > 1 {
+		suffix = fmt.Sprintf("%d", step)
+	}
+	switch style {
+	case NameSnake:
+		if suffix != "" {
+			suffix = "_" + suffix
+		}
+		return strings.ToUpper(a.FuncName) + "_MASK" + suffix
+	default:
+		return a.TypeName + "Mask" + suffix
+	}
+}
+
 func ParseArgDecodeSteps(raw string) ([]ArgDecodeStep, int) {
 	// Deals with strings like these from the "operands" file and normalizes
 	// them to just be a sequence of "mask, then shift" operations whose
@@ -50,7 +182,8 @@ func ParseArgDecodeSteps(raw string) ([]ArgDecodeStep, int) {
 		brack := strings.IndexByte(rawPart, '[')
 		switch {
 		case brack == -1:
-			// A simple left-justified field, then.
+			// A simple left-justified field, then. A single bit can be
+			// written as just its position.
 			rawTop, rawBottom := partition(rawPart, ":")
 			if rawBottom == "" {
 				rawBottom = rawTop
@@ -63,6 +196,10 @@ func ParseArgDecodeSteps(raw string) ([]ArgDecodeStep, int) {
 			if err != nil {
 				continue
 			}
+			if top < bottom {
+				warnSpec("operand encoding %q has reversed bit range %s", raw, rawPart)
+				top, bottom = bottom, top
+			}
 			mask := rangeMask(uint(top), uint(bottom))
 
 			ret = append(ret, ArgDecodeStep{
@@ -70,6 +207,10 @@ func ParseArgDecodeSteps(raw string) ([]ArgDecodeStep, int) {
 				RightShift: int(bottom),
 			})
 
+			if width := int(top - bottom); width > maxDestBit {
+				maxDestBit = width
+			}
+
 		default:
 			// A more complicated sequence of operations gathering values
 			// for a single field from several separate sources. In this
@@ -99,6 +240,10 @@ func ParseArgDecodeSteps(raw string) ([]ArgDecodeStep, int) {
 				if err != nil {
 					continue
 				}
+				if destTop < destBottom {
+					warnSpec("operand encoding %q has reversed bit range %s", raw, rawConcat)
+					destTop, destBottom = destBottom, destTop
+				}
 				width := destTop - destBottom
 				srcBottom := srcTop - width
 
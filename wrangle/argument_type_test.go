@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseArgDecodeSteps(t *testing.T) {
+	tests := []struct {
+		raw       string
+		wantSteps []ArgDecodeStep
+		wantWidth int
+		wantWarn  bool
+	}{
+		{
+			"11",
+			[]ArgDecodeStep{{Mask: 0x00000800, RightShift: 11}},
+			1,
+			false,
+		},
+		{
+			"11:7",
+			[]ArgDecodeStep{{Mask: 0x00000f80, RightShift: 7}},
+			5,
+			false,
+		},
+		{
+			// A reversed range is tolerated, but reported.
+			"7:11",
+			[]ArgDecodeStep{{Mask: 0x00000f80, RightShift: 7}},
+			5,
+			true,
+		},
+		{
+			"24:20[4:0]",
+			[]ArgDecodeStep{{Mask: 0x01f00000, RightShift: 20}},
+			5,
+			false,
+		},
+		{
+			"12[5],6:2[4:0]",
+			[]ArgDecodeStep{
+				{Mask: 0x00001000, RightShift: 7},
+				{Mask: 0x0000007c, RightShift: 2},
+			},
+			6,
+			false,
+		},
+		{
+			"31:25[12|10:5],11:7[4:1|11]",
+			[]ArgDecodeStep{
+				{Mask: 0x80000000, RightShift: 19},
+				{Mask: 0x7e000000, RightShift: 20},
+				{Mask: 0x00000f00, RightShift: 7},
+				{Mask: 0x00000080, RightShift: -4},
+			},
+			13,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			specWarnings = nil
+			steps, width := ParseArgDecodeSteps(test.raw)
+			if !reflect.DeepEqual(steps, test.wantSteps) {
+				t.Errorf("wrong steps\ngot:  %#v\nwant: %#v", steps, test.wantSteps)
+			}
+			if width != test.wantWidth {
+				t.Errorf("wrong width %d; want %d", width, test.wantWidth)
+			}
+			if gotWarn := len(specWarnings) != 0; gotWarn != test.wantWarn {
+				t.Errorf("wrong warnings %q; want warning: %t", specWarnings, test.wantWarn)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// backendFunc generates the code for one output language into the given
+// directory, returning the names of the files it created in the order it
+// created them.
+type backendFunc func(dir string, isa *ISA, style NameStyle) ([]string, error)
+
+// backendGenerators are the code generators that the -backends option can
+// select, each of which writes into a subdirectory of the same name.
+var backendGenerators = map[string]backendFunc{
+	"rust": generateRustFragments,
+	"go": func(dir string, isa *ISA, style NameStyle) ([]string, error) {
+		return generateGoFragments(dir, isa)
+	},
+	"cpp": func(dir string, isa *ISA, style NameStyle) ([]string, error) {
+		return generateCppFragments(dir, isa)
+	},
+}
+
+// parseBackends parses a comma-separated list of backend names, as given
+// to the -backends option.
+func parseBackends(raw string) ([]string, error) {
+	var ret []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := backendGenerators[name]; !ok {
+			return nil, fmt.Errorf("unknown backend %q: must be one of %s", name, strings.Join(backendNames(), ", "))
+		}
+		ret = append(ret, name)
+	}
+	return ret, nil
+}
+
+func backendNames() []string {
+	ret := make([]string, 0, len(backendGenerators))
+	for name := range backendGenerators {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// runBackends runs each of the named backends in turn, writing into
+// subdirectories of the given directory, and then writes a manifest of the
+// files that the successful backends generated. A failing backend doesn't
+// prevent the others from running, but causes an error to be returned once
+// all of them are done.
+func runBackends(dir string, names []string, isa *ISA, style NameStyle) error {
+	var failed, succeeded []string
+	files := make(map[string][]string)
+	timer := startPhase("")
+	for _, name := range names {
+		timer.Next("generate " + name)
+		created, err := backendGenerators[name](filepath.Join(dir, name), isa, style)
+		if err != nil {
+			log.Printf("%s: failed: %s", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		log.Printf("%s: ok", name)
+		succeeded = append(succeeded, name)
+		files[name] = created
+	}
+	timer.Next("write manifest")
+	if err := writeManifest(dir, isa, succeeded, files); err != nil {
+		return fmt.Errorf("failed to write manifest: %s", err)
+	}
+	timer.Stop()
+
+	if len(failed) != 0 {
+		return fmt.Errorf("%d of %d backends failed: %s", len(failed), len(names), strings.Join(failed, ", "))
+	}
+	return nil
+}
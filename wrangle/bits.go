@@ -5,12 +5,27 @@ import (
 )
 
 type bits8 uint8
+type bits16 uint16
 type bits32 uint32
 
+// parcelBytes is the length of an instruction parcel, the unit in which the
+// lengths of instructions are measured.
+const parcelBytes = 2
+
+// parcelCount returns the number of 16-bit parcels spanned by an
+// instruction of the given length in bytes.
+func parcelCount(widthBytes int) int {
+	return (widthBytes + parcelBytes - 1) / parcelBytes
+}
+
 func (v bits8) String() string {
 	return fmt.Sprintf("0b%08b", v)
 }
 
+func (v bits16) String() string {
+	return fmt.Sprintf("0b%016b", v)
+}
+
 func (v bits32) String() string {
 	return fmt.Sprintf("0b%032b", v)
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParcelCount(t *testing.T) {
+	tests := []struct {
+		widthBytes int
+		want       int
+	}{
+		{0, 0},
+		{1, 1},
+		{2, 1},
+		{3, 2},
+		{4, 2},
+		{6, 3},
+		{8, 4},
+	}
+
+	for _, test := range tests {
+		if got := parcelCount(test.widthBytes); got != test.want {
+			t.Errorf("parcelCount(%d) = %d; want %d", test.widthBytes, got, test.want)
+		}
+	}
+}
+
+func TestSizeBytes(t *testing.T) {
+	tests := []struct {
+		size Size
+		want int
+	}{
+		{RV32, 4},
+		{RV64, 8},
+		{RV128, 16},
+	}
+
+	for _, test := range tests {
+		if got := test.size.Bytes(); got != test.want {
+			t.Errorf("RV%d.Bytes() = %d; want %d", int(test.size), got, test.want)
+		}
+	}
+}
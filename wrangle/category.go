@@ -0,0 +1,86 @@
+package main
+
+// majorOpcodeCategories maps the names of the major opcodes to the
+// categories of the operations they contain, for grouping operations in
+// user interfaces and statistics.
+var majorOpcodeCategories = map[string]string{
+	"LOAD":      "load",
+	"LOAD-FP":   "load",
+	"STORE":     "store",
+	"STORE-FP":  "store",
+	"BRANCH":    "branch",
+	"JAL":       "jump",
+	"JALR":      "jump",
+	"OP":        "arithmetic",
+	"OP-IMM":    "arithmetic",
+	"OP-32":     "arithmetic",
+	"OP-IMM-32": "arithmetic",
+	"LUI":       "arithmetic",
+	"AUIPC":     "arithmetic",
+
+	"AMO":      "atomic",
+	"MISC-MEM": "fence",
+	"SYSTEM":   "system",
+	"OP-FP":    "float-arith",
+	"MADD":     "float-arith",
+	"MSUB":     "float-arith",
+	"NMSUB":    "float-arith",
+	"NMADD":    "float-arith",
+}
+
+// rv128OpcodeCategories gives the categories of the operations in the
+// major opcodes that are reserved for custom extensions except in RV128,
+// which uses them for its OP-IMM-64 and OP-64 operations. They are not
+// loaded as major opcodes, so are identified by their opcode bits.
+var rv128OpcodeCategories = map[bits8]string{
+	0b1011011: "arithmetic",
+	0b1111011: "arithmetic",
+}
+
+// categoryOther is the category of operations that don't fit any other.
+const categoryOther = "other"
+
+// categories lists all of the categories that Category can return, in a
+// fixed order so that generated enumerations of them are stable.
+var categories = []string{
+	"load",
+	"store",
+	"branch",
+	"jump",
+	"arithmetic",
+	"atomic",
+	"fence",
+	"system",
+	"float-arith",
+	categoryOther,
+}
+
+// Category returns a broad category for the operation, such as "load" or
+// "branch", based on its major opcode. Compressed operations have no major
+// opcode, so they take the category of the operation they expand to.
+func (op *Operation) Category(isa *ISA) string {
+	if op.MajorOpcode == nil && op.WidthBytes() == 4 {
+		if category, ok := rv128OpcodeCategories[bits8(op.Test&0b1111111)]; ok {
+			return category
+		}
+		return categoryOther
+	}
+	if op.MajorOpcode == nil {
+		target, ok := isa.Expansions[op.Name]
+		if !ok {
+			return categoryOther
+		}
+		for _, ops := range [][]Operation{isa.Ops, isa.ExcludedOps} {
+			for i := range ops {
+				if ops[i].Name == target && ops[i].MajorOpcode != nil {
+					return ops[i].Category(isa)
+				}
+			}
+		}
+		return categoryOther
+	}
+	if category, ok := majorOpcodeCategories[op.MajorOpcode.Name]; ok {
+		return category
+	}
+	return categoryOther
+}
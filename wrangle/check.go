@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+)
+
+// Severity distinguishes problems that make the spec inconsistent from
+// those that are merely suspicious.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Problem is an inconsistency found in a loaded ISA.
+type Problem struct {
+	// Code identifies the kind of problem, for filtering problems
+	// programmatically. The codes are stable, unlike the messages.
+	Code     string
+	Severity Severity
+
+	// Location names the entry that has the problem, such as an operation
+	// or codec, or is empty for problems that involve several entries
+	// equally.
+	Location string
+	Message  string
+}
+
+func (p Problem) String() string {
+	if p.Location == "" {
+		return p.Message
+	}
+	return p.Location + ": " + p.Message
+}
+
+// Validate runs all of the consistency checks on the ISA, returning every
+// problem found. This includes the anomalies that the loader tolerated by
+// skipping whatever was problematic.
+func (isa *ISA) Validate() []Problem {
+	var problems []Problem
+	for _, msg := range isa.LoadWarnings {
+		problems = append(problems, Problem{Code: "load", Severity: SeverityError, Message: msg})
+	}
+	problems = append(problems, checkAnomalies(isa)...)
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		problems = append(problems, checkOperationTest(op)...)
+		problems = append(problems, checkOperationMasks(isa, op)...)
+		problems = append(problems, checkOperandOrder(op)...)
+		problems = append(problems, checkImmediateWidths(isa, op)...)
+	}
+	problems = append(problems, checkExpansions(isa)...)
+	problems = append(problems, checkStandards(isa)...)
+	problems = append(problems, checkUnused(isa)...)
+	return problems
+}
+
+// checkExpansions verifies that both sides of each entry in the compressed
+// instruction expansion table name known operations.
+func checkExpansions(isa *ISA) []Problem {
+	// Operations excluded by an extension filter still exist, so they
+	// don't make an expansion dangling.
+	names := make(map[string]struct{})
+	for _, ops := range [][]Operation{isa.Ops, isa.ExcludedOps} {
+		for _, op := range ops {
+			names[op.Name] = struct{}{}
+		}
+	}
+
+	var problems []Problem
+	for _, from := range sortedStringKeys(isa.Expansions) {
+		to := isa.Expansions[from]
+		if _, ok := names[from]; !ok {
+			problems = append(problems, Problem{"unknown-expansion-source", SeverityError, from, "expansion source is not a known operation"})
+		}
+		if _, ok := names[to]; !ok {
+			problems = append(problems, Problem{"unknown-expansion-target", SeverityError, from, fmt.Sprintf("expands to unknown operation %q", to)})
+		}
+	}
+	return problems
+}
+
+// checkStandards looks for operations whose standards tagging is
+// suspicious: tagged with an extension that the extensions file doesn't
+// describe, or tagged only for RV64 when an RV32-only operation has the
+// same encoding and operands, which usually means that a single operation
+// was meant to be tagged for both.
+func checkStandards(isa *ISA) []Problem {
+	var problems []Problem
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		for _, ext := range op.Standards.Extensions() {
+			if _, ok := isa.ExtensionNames[ext]; !ok {
+				problems = append(problems, Problem{"unknown-extension", SeverityError, op.Name, fmt.Sprintf("tagged with extension %s, which is not in the extensions file", ext)})
+			}
+		}
+
+		if !op.Standards.Has(RV64Any) || op.Standards.Has(RV32Any) {
+			continue
+		}
+		for j := range isa.Ops {
+			other := &isa.Ops[j]
+			if !other.Standards.Has(RV32Any) || other.Standards.Has(RV64Any) {
+				continue
+			}
+			if other.Mask != op.Mask || other.Test != op.Test || other.Codec != op.Codec {
+				continue
+			}
+			problems = append(problems, Problem{"rv64-only-duplicate", SeverityError, op.Name, fmt.Sprintf("tagged for RV64 but not RV32, yet has the same encoding as RV32 operation %q", other.Name)})
+		}
+	}
+	return problems
+}
+
+// checkUnused reports codecs that no operation uses and arguments that no
+// codec uses. These are only warnings, since an entry may be retained
+// deliberately for operations that are yet to be added.
+func checkUnused(isa *ISA) []Problem {
+	usedCodecs := make(map[string]struct{})
+	for _, ops := range [][]Operation{isa.Ops, isa.ExcludedOps} {
+		for _, op := range ops {
+			usedCodecs[op.Codec.Name] = struct{}{}
+		}
+	}
+	usedArgs := make(map[string]struct{})
+	for _, codec := range isa.Codecs {
+		for _, argName := range codec.Operands {
+			usedArgs[argName] = struct{}{}
+		}
+	}
+
+	var warnings []Problem
+	for _, name := range sortedCodecNames(isa.Codecs) {
+		if _, ok := usedCodecs[name]; !ok {
+			warnings = append(warnings, Problem{"unused-codec", SeverityWarning, "", fmt.Sprintf("codec %q is not used by any operation", name)})
+		}
+	}
+	for _, name := range sortedArgNames(isa.Arguments) {
+		if _, ok := usedArgs[name]; !ok {
+			warnings = append(warnings, Problem{"unused-operand", SeverityWarning, "", fmt.Sprintf("operand %q is not used by any codec", name)})
+		}
+	}
+	return warnings
+}
+
+// checkOperationTest verifies that an operation's encoding doesn't require
+// a value for any bit outside of its mask, which would be a contradiction.
+func checkOperationTest(op *Operation) []Problem {
+	if extra := op.Test &^ op.Mask; extra != 0 {
+		return []Problem{{"test-outside-mask", SeverityError, op.Name, fmt.Sprintf("bits %s are set in the encoding but not in its mask", extra)}}
+	}
+	return nil
+}
+
+// checkOperationMasks verifies that each bit of an operation's encoding is
+// either fixed or part of exactly one operand, but not both, unless the
+// spec marks it as ignored.
+func checkOperationMasks(isa *ISA, op *Operation) []Problem {
+	var problems []Problem
+
+	fixed := op.FixedMask()
+	operands := op.OperandMask(isa)
+	all := rangeMask(uint(op.WidthBytes()*8-1), 0)
+
+	// Overlaps are reported for each operand so that it's clear which of
+	// the codec's operands disagrees with the encoding.
+	for _, argName := range op.Codec.Operands {
+		arg := isa.Argument(argName, op.Standards.MinSize())
+		if arg == nil {
+			continue
+		}
+		argMask := arg.Mask()
+		switch overlap := fixed & argMask; {
+		case overlap == 0:
+		case overlap == argMask:
+			// This is legitimate where the encoding pins a register,
+			// such as the sp of c.addi16sp, so it's only suspicious.
+			problems = append(problems, Problem{"operand-fixed", SeverityWarning, op.Name, fmt.Sprintf("operand %s is entirely fixed by the encoding", arg.Name)})
+		default:
+			problems = append(problems, Problem{"operand-partly-fixed", SeverityError, op.Name, fmt.Sprintf("operand %s bits %s are also fixed by the encoding", arg.Name, overlap)})
+		}
+	}
+	if missing := all &^ (fixed | operands | op.Ignore); missing != 0 {
+		problems = append(problems, Problem{"uncovered-bits", SeverityError, op.Name, fmt.Sprintf("bits %s are neither fixed nor part of an operand", missing)})
+	}
+	return problems
+}
+
+// operandRoleRanks gives the conventional order of the register operands
+// of an operation, by role. Any other operands conventionally follow all
+// of the registers.
+var operandRoleRanks = map[string]int{"rd": 0, "rs1": 1, "rs2": 2, "rs3": 3}
+
+// checkOperandOrder warns if an operation's operands aren't in the
+// conventional order: the destination register, then the source registers
+// in order, then any other operands. This is only a heuristic, but an
+// unusual order usually means that operands were transposed when the
+// operation was transcribed.
+func checkOperandOrder(op *Operation) []Problem {
+	rank := func(argName string) int {
+		ret := len(operandRoleRanks)
+		for _, role := range operandRoles(argName) {
+			if r, ok := operandRoleRanks[role]; ok && r < ret {
+				ret = r
+			}
+		}
+		return ret
+	}
+
+	operands := op.Codec.Operands
+	for i := 1; i < len(operands); i++ {
+		if rank(operands[i-1]) > rank(operands[i]) {
+			return []Problem{{"operand-order", SeverityWarning, op.Name, fmt.Sprintf("operand %s comes before %s, unlike the conventional order of rd, rs1, rs2, rs3, and then any others", operands[i-1], operands[i])}}
+		}
+	}
+	return nil
+}
+
+// codecImmediateBits gives the total number of instruction bits that the
+// immediate operands of each instruction format occupy, such as 12 for
+// I-type and 20 for U-type, keyed by codec name. A codec that isn't listed
+// takes the width of its type and subtype without the format variant, or
+// failing that of its type alone, so "ci·lwsp+f" takes the width of "ci".
+// A shift whose amount is XLEN-wide takes the width xlenShiftBits.
+var codecImmediateBits = map[string]int{
+	"none":    0,
+	"u":       20,
+	"uj":      20,
+	"i":       12,
+	"i·sh":    xlenShiftBits,
+	"i·sh5":   5,
+	"i·sh6":   6,
+	"i·csr+i": 17, // the CSR number and a 5-bit immediate in place of rs1
+	"s":       12,
+	"sb":      12,
+	"r":       0,
+	"r4":      0,
+	"cr":      0,
+	"ci":      6,
+	"ci·none": 0,
+	"ci·sh":   xlenShiftBits,
+	"css":     6,
+	"ciw":     8,
+	"cl":      5,
+	"cs":      0,
+	"cs·sw":   5,
+	"cs·sd":   5,
+	"cs·sq":   5,
+	"cb":      8,
+	"cb·imm":  6,
+	"cb·sh":   xlenShiftBits,
+	"cj":      11,
+}
+
+// xlenShiftBits stands in codecImmediateBits for the width of a shift
+// amount that can select any bit of a register, which is 5 for RV32, 6 for
+// RV64, and 7 for RV128.
+const xlenShiftBits = -1
+
+// expectedImmediateBits returns the entry of codecImmediateBits for the
+// given codec, and false if its format isn't listed.
+func expectedImmediateBits(codec string) (int, bool) {
+	subtype, _ := partition(codec, "+")
+	typ, _ := partition(subtype, "·")
+	for _, name := range []string{codec, subtype, typ} {
+		if bits, ok := codecImmediateBits[name]; ok {
+			return bits, true
+		}
+	}
+	return 0, false
+}
+
+// checkImmediateWidths verifies that the immediate operands of an
+// operation occupy as many bits of the instruction as its codec's format
+// provides for immediates. A mismatch usually means that an immediate's
+// bit ranges were transcribed incorrectly.
+func checkImmediateWidths(isa *ISA, op *Operation) []Problem {
+	want, ok := expectedImmediateBits(op.Codec.Name)
+	if !ok {
+		return nil
+	}
+	if want == xlenShiftBits {
+		want = bits.TrailingZeros(uint(op.Standards.MinSize()))
+	}
+	var imms []*Argument
+	got := 0
+	for _, argName := range op.Codec.Operands {
+		arg := isa.Argument(argName, op.Standards.MinSize())
+		if arg == nil || !arg.IsImmediate() {
+			continue
+		}
+		imms = append(imms, arg)
+		got += bits.OnesCount32(uint32(arg.Mask()))
+	}
+	if got == want {
+		return nil
+	}
+
+	var msg string
+	switch len(imms) {
+	case 0:
+		msg = fmt.Sprintf("codec %s has no immediate operand, but its format has a %d-bit immediate", op.Codec.Name, want)
+	case 1:
+		msg = fmt.Sprintf("operand %s of codec %s is a %d-bit field, but its format has a %d-bit immediate", imms[0].Name, op.Codec.Name, got, want)
+	default:
+		names := make([]string, len(imms))
+		for i, arg := range imms {
+			names[i] = arg.Name
+		}
+		msg = fmt.Sprintf("operands %s of codec %s occupy %d bits, but its format has a %d-bit immediate", strings.Join(names, ", "), op.Codec.Name, got, want)
+	}
+	return []Problem{{"immediate-width", SeverityError, op.Name, msg}}
+}
+
+// checkAnomalies looks for problems in the loaded ISA that would cause
+// generated code to be incorrect or fail to compile: ambiguous encodings
+// and identifier collisions.
+func checkAnomalies(isa *ISA) []Problem {
+	var problems []Problem
+	for _, size := range []Size{RV32, RV64, RV128} {
+		anyStd := size.Any()
+		var ops []*Operation
+		for i := range isa.Ops {
+			if op := &isa.Ops[i]; op.Standards.Has(anyStd) {
+				ops = append(ops, op)
+			}
+		}
+
+		typeNames := make(map[string]string)
+		for i, a := range ops {
+			if other, ok := typeNames[a.TypeName]; ok && other != a.Name {
+				problems = append(problems, Problem{"identifier-collision", SeverityError, "", fmt.Sprintf("RV%d operations %q and %q both have identifier %s", int(size), other, a.Name, a.TypeName)})
+			}
+			typeNames[a.TypeName] = a.Name
+
+			for _, b := range ops[i+1:] {
+				// Two operations are ambiguous if some instruction word
+				// could match both and we have no way to prefer one.
+				overlap := (a.Test^b.Test)&a.Mask&b.Mask == 0
+				if overlap && a.Specificity() == b.Specificity() {
+					problems = append(problems, Problem{"ambiguous-encoding", SeverityError, "", fmt.Sprintf("RV%d operations %q and %q have ambiguous encodings", int(size), a.Name, b.Name)})
+				}
+			}
+		}
+	}
+
+	funcNames := make(map[string]string)
+	for _, name := range sortedArgNames(isa.Arguments) {
+		arg := isa.Arguments[name]
+		if other, ok := funcNames[arg.FuncName]; ok {
+			problems = append(problems, Problem{"identifier-collision", SeverityError, "", fmt.Sprintf("operands %q and %q both have identifier %s", other, arg.Name, arg.FuncName)})
+		}
+		funcNames[arg.FuncName] = arg.Name
+	}
+	return problems
+}
+
+// findSpecAnomalies reports, via warnSpec, the problems that checkAnomalies
+// finds, so that they are fatal in strict mode.
+func findSpecAnomalies(isa *ISA) {
+	for _, problem := range checkAnomalies(isa) {
+		warnSpec("%s", problem)
+	}
+}
+
+func printSpecProblems(w io.Writer, isa *ISA) error {
+	errors := 0
+	for _, problem := range isa.Validate() {
+		if problem.Severity == SeverityWarning {
+			fmt.Fprintf(w, "warning: %s\n", problem)
+			continue
+		}
+		fmt.Fprintln(w, problem)
+		errors++
+	}
+	if errors != 0 {
+		return fmt.Errorf("found %d problems in the spec", errors)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateCommittedSpec(t *testing.T) {
+	isa := loadTestISA(t)
+	for _, problem := range isa.Validate() {
+		if problem.Severity == SeverityError {
+			t.Errorf("%s [%s]", problem, problem.Code)
+		}
+	}
+}
+
+func TestCheckOperationMasks(t *testing.T) {
+	isa := loadTestISA(t)
+
+	// fence and fence.i mark their unused fields as ignored, so those
+	// bits aren't uncovered.
+	for _, name := range []string{"fence", "fence.i"} {
+		op := findTestOp(isa, name)
+		if op == nil {
+			t.Fatalf("no operation %s", name)
+		}
+		if op.Ignore == 0 {
+			t.Errorf("%s has no ignored bits", name)
+		}
+		for _, problem := range checkOperationMasks(isa, op) {
+			t.Errorf("%s: unexpected problem %s", name, problem)
+		}
+
+		// Without the ignored bits, the same fields are uncovered.
+		unignored := *op
+		unignored.Ignore = 0
+		problems := checkOperationMasks(isa, &unignored)
+		if len(problems) != 1 || problems[0].Code != "uncovered-bits" {
+			t.Errorf("%s without ignored bits: got problems %v; want uncovered bits", name, problems)
+		}
+	}
+}
+
+func TestValidateOrderingOperands(t *testing.T) {
+	isa := loadTestISA(t)
+	if isa.Arguments["aqrl"] == nil {
+		t.Fatal("no aqrl operand")
+	}
+
+	// The atomics encode aq and rl together as the aqrl ordering, so
+	// separate operands for them would be unused.
+	for _, problem := range isa.Validate() {
+		if problem.Code != "unused-operand" {
+			continue
+		}
+		for _, name := range []string{"aq", "rl", "aqrl"} {
+			if strings.Contains(problem.Message, fmt.Sprintf("%q", name)) {
+				t.Errorf("unexpected problem: %s", problem)
+			}
+		}
+	}
+}
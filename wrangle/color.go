@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	ansiReset    = "\x1b[0m"
+	ansiBold     = "\x1b[1m"
+	ansiYellow   = "\x1b[33m"
+	ansiCyan     = "\x1b[36m"
+	ansiDarkGray = "\x1b[90m"
+)
+
+// colors highlights parts of the interactive output when it's going to a
+// terminal. The zero value leaves everything uncolored.
+type colors struct {
+	enabled bool
+}
+
+// terminalColors returns the colors to use for output to the given
+// writer, which are enabled only if it's a terminal and the NO_COLOR
+// environment variable is unset or empty.
+func terminalColors(w io.Writer) colors {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("NO_COLOR") != "" {
+		return colors{}
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return colors{}
+	}
+	return colors{enabled: info.Mode()&os.ModeCharDevice != 0}
+}
+
+func (c colors) paint(code, s string) string {
+	if !c.enabled || s == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// Mnemonic highlights an operation name.
+func (c colors) Mnemonic(s string) string {
+	return c.paint(ansiBold, s)
+}
+
+// Operand highlights an operand value.
+func (c colors) Operand(s string) string {
+	return c.paint(ansiCyan, s)
+}
+
+// Bits formats an instruction word in binary, as bits32.String does, with
+// the bits in the fixed mask in one color, those in the operand mask in
+// another, and any others dimmed.
+func (c colors) Bits(word, fixed, operands bits32) string {
+	if !c.enabled {
+		return word.String()
+	}
+	var buf strings.Builder
+	buf.WriteString("0b")
+	run, runCode := "", ""
+	for bit := 31; bit >= 0; bit-- {
+		mask := bits32(1) << uint(bit)
+		code := ansiDarkGray
+		switch {
+		case fixed&mask != 0:
+			code = ansiYellow
+		case operands&mask != 0:
+			code = ansiCyan
+		}
+		if code != runCode {
+			buf.WriteString(c.paint(runCode, run))
+			run, runCode = "", code
+		}
+		if word&mask != 0 {
+			run += "1"
+		} else {
+			run += "0"
+		}
+	}
+	buf.WriteString(c.paint(runCode, run))
+	return buf.String()
+}
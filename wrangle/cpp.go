@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func generateCppFragments(dir string, isa *ISA) ([]string, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := filepath.Join(dir, "riscv.hpp")
+	if err := generateCppHeader(filename, isa); err != nil {
+		return nil, err
+	}
+	return []string{filename}, nil
+}
+
+// generateCppHeader writes a header-only C++17 decoder in which each
+// operation is a struct holding its typed operands, and a decoded
+// instruction is a std::variant over all of those structs.
+func generateCppHeader(filename string, isa *ISA) error {
+	f, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := newIndentWriter(f)
+
+	writeFileHeader(w, cppComments)
+	w.WriteString("#pragma once\n\n")
+	w.WriteString("#include <cstdint>\n")
+	w.WriteString("#include <optional>\n")
+	w.WriteString("#include <variant>\n\n")
+	w.WriteString("namespace riscv {\n\n")
+
+	w.WriteString("/// A general-purpose integer register, x0 through x31.\n")
+	w.WriteString("struct IntRegister {\n")
+	w.WriteString("    uint8_t num;\n")
+	w.WriteString("};\n\n")
+	w.WriteString("/// A floating-point register, f0 through f31.\n")
+	w.WriteString("struct FloatRegister {\n")
+	w.WriteString("    uint8_t num;\n")
+	w.WriteString("};\n\n")
+	w.WriteString("/// The memory ordering constraint of an atomic operation, as given by\n")
+	w.WriteString("/// its aq (acquire) and rl (release) bits.\n")
+	w.WriteString("enum class Ordering : uint8_t {\n")
+	w.WriteString("    Relaxed = 0b00,\n")
+	w.WriteString("    Release = 0b01,\n")
+	w.WriteString("    Acquire = 0b10,\n")
+	w.WriteString("    AcquireRelease = 0b11,\n")
+	w.WriteString("};\n\n")
+	w.WriteString("/// Sign-extends the low Width bits of raw.\n")
+	w.WriteString("template <unsigned Width>\n")
+	w.WriteString("constexpr int32_t sign_extend(uint32_t raw) {\n")
+	w.WriteString("    return static_cast<int32_t>(raw << (32 - Width)) >> (32 - Width);\n")
+	w.WriteString("}\n\n")
+
+	w.WriteString("/// Enumeration of top-level opcodes for full-length operations.\n")
+	w.WriteString("enum class Opcode : uint8_t {\n")
+	for _, majorOp := range sortedMajorOpcodes(isa.MajorOpcodes) {
+		fmt.Fprintf(w, "    %s = 0x%02x,\n", majorOp.TypeName, uint8(majorOp.Num))
+	}
+	w.WriteString("};\n\n")
+
+	// Each argument gets a function to gather its raw bits from an
+	// instruction word, which the decoder then converts to the argument's
+	// type.
+	for _, arg := range sortedArgEncodings(isa.Arguments) {
+		fmt.Fprintf(w, "inline uint32_t raw_%s(uint32_t word) {\n", arg.FuncName)
+		w.WriteString("    uint32_t raw = 0;\n")
+		for _, step := range arg.Decoding {
+			switch {
+			case step.RightShift == 0:
+				fmt.Fprintf(w, "    raw |= (word & 0x%08x);\n", uint32(step.Mask))
+			case step.RightShift < 0:
+				fmt.Fprintf(w, "    raw |= (word & 0x%08x) << %d;\n", uint32(step.Mask), -step.RightShift)
+			default:
+				fmt.Fprintf(w, "    raw |= (word & 0x%08x) >> %d;\n", uint32(step.Mask), step.RightShift)
+			}
+		}
+		w.WriteString("    return raw;\n")
+		w.WriteString("}\n\n")
+	}
+
+	// As with the Go backend, the same operation name appearing for
+	// several base ISA sizes is represented by only one struct.
+	kinds := goOpKinds(isa)
+	for _, op := range kinds {
+		fmt.Fprintf(w, "/// %s\n", op.DocText())
+		fmt.Fprintf(w, "struct %s {\n", op.TypeName)
+		for _, argName := range op.Codec.Operands {
+			arg := isa.Arguments[argName]
+			fmt.Fprintf(w, "    %s %s;\n", cppTypeForArg(arg), arg.FuncLocalName)
+		}
+		w.WriteString("};\n\n")
+	}
+
+	w.WriteString("using Operation = std::variant<\n")
+	for i, op := range kinds {
+		sep := ","
+		if i == len(kinds)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(w, "    %s%s\n", op.TypeName, sep)
+	}
+	w.WriteString(">;\n")
+
+	for _, size := range []Size{RV32, RV64} {
+		anyStd := size.Any()
+		var ops []*Operation
+		for i := range isa.Ops {
+			if op := &isa.Ops[i]; op.Standards.Has(anyStd) {
+				ops = append(ops, op)
+			}
+		}
+		sort.SliceStable(ops, func(i, j int) bool {
+			return ops[i].Specificity() > ops[j].Specificity()
+		})
+
+		fmt.Fprintf(w, "\ninline std::optional<Operation> decode_rv%d(uint32_t word) {\n", int(size))
+		for _, op := range ops {
+			fmt.Fprintf(w, "    if ((word & 0x%08x) == 0x%08x) {\n", uint32(op.Mask), uint32(op.Test))
+			if len(op.Constraints) != 0 {
+				tests := make([]string, len(op.Constraints))
+				for i, cond := range op.Constraints {
+					tests[i] = cppConditionExpr(cond, size)
+				}
+				fmt.Fprintf(w, "        if (!(%s)) {\n", strings.Join(tests, " && "))
+				w.WriteString("            return std::nullopt;\n")
+				w.WriteString("        }\n")
+			}
+			values := make([]string, len(op.Codec.Operands))
+			for i, argName := range op.Codec.Operands {
+				values[i] = cppArgValue(isa.Argument(argName, size))
+			}
+			fmt.Fprintf(w, "        return %s{%s};\n", op.TypeName, strings.Join(values, ", "))
+			w.WriteString("    }\n")
+		}
+		w.WriteString("    return std::nullopt;\n")
+		w.WriteString("}\n")
+	}
+
+	w.WriteString("\n/// Decodes the given instruction word under the given base ISA width,\n")
+	w.WriteString("/// returning nothing if it is not a valid instruction. Compressed\n")
+	w.WriteString("/// instructions must have the upper parcel set to zero.\n")
+	w.WriteString("inline std::optional<Operation> decode(uint32_t word, int xlen = 64) {\n")
+	w.WriteString("    switch (xlen) {\n")
+	for _, size := range []Size{RV32, RV64} {
+		fmt.Fprintf(w, "    case %d:\n", int(size))
+		fmt.Fprintf(w, "        return decode_rv%d(word);\n", int(size))
+	}
+	w.WriteString("    default:\n")
+	w.WriteString("        return std::nullopt;\n")
+	w.WriteString("    }\n")
+	w.WriteString("}\n\n")
+
+	writeCppExecStubs(w, kinds)
+
+	w.WriteString("} // namespace riscv\n")
+
+	return f.Close()
+}
+
+// writeCppExecStubs writes a stub execute function for each operation,
+// with the operation's C pseudocode as a comment in its body, and a
+// function that dispatches a decoded operation to the appropriate stub.
+// These give a starting point for growing the decoder into an interpreter,
+// where Hart is whatever type represents the machine state.
+func writeCppExecStubs(w *indentWriter, kinds []*Operation) {
+	for _, op := range kinds {
+		fmt.Fprintf(w, "/// Executes %s. Not yet implemented.\n", strings.ToUpper(op.Name))
+		w.WriteString("template <typename Hart>\n")
+		fmt.Fprintf(w, "void execute(Hart &hart, const %s &op) {\n", op.TypeName)
+		if op.PseudocodeC != "" {
+			for _, stmt := range strings.Split(op.PseudocodeC, ";") {
+				if stmt = strings.TrimSpace(stmt); stmt != "" {
+					fmt.Fprintf(w, "    // %s;\n", stmt)
+				}
+			}
+		} else {
+			w.WriteString("    // No pseudocode is available for this operation.\n")
+		}
+		w.WriteString("    (void)hart;\n")
+		w.WriteString("    (void)op;\n")
+		w.WriteString("}\n\n")
+	}
+
+	w.WriteString("/// Executes the given decoded operation using the stubs above.\n")
+	w.WriteString("template <typename Hart>\n")
+	w.WriteString("void execute(Hart &hart, const Operation &op) {\n")
+	w.WriteString("    std::visit([&hart](const auto &inner) { execute(hart, inner); }, op);\n")
+	w.WriteString("}\n\n")
+}
+
+// cppIsFloatReg returns true if the given argument is a compressed
+// register field that selects a floating-point register, which the
+// operands file distinguishes only by naming convention.
+func cppIsFloatReg(arg *Argument) bool {
+	return arg.Type == ArgCompressedReg && strings.HasPrefix(arg.Name, "cf")
+}
+
+func cppTypeForArg(arg *Argument) string {
+	switch {
+	case arg.Type == ArgIntReg:
+		return "IntRegister"
+	case arg.Type == ArgFloatReg:
+		return "FloatRegister"
+	case arg.Type == ArgCompressedReg:
+		if cppIsFloatReg(arg) {
+			return "FloatRegister"
+		}
+		return "IntRegister"
+	case arg.Type == ArgOrdering:
+		return "Ordering"
+	case arg.IsSigned():
+		return "int32_t"
+	case arg.EncWidth == 1:
+		return "bool"
+	default:
+		return "uint32_t"
+	}
+}
+
+// cppArgValue returns a C++ expression that extracts the given argument
+// from "word" as a value of the type returned by cppTypeForArg.
+func cppArgValue(arg *Argument) string {
+	raw := fmt.Sprintf("raw_%s(word)", arg.FuncName)
+	switch ty := cppTypeForArg(arg); ty {
+	case "IntRegister", "FloatRegister":
+		if arg.Type == ArgCompressedReg {
+			// Compressed register fields select from x8 (or f8) onwards.
+			return fmt.Sprintf("%s{static_cast<uint8_t>(%s + 8)}", ty, raw)
+		}
+		return fmt.Sprintf("%s{static_cast<uint8_t>(%s)}", ty, raw)
+	case "Ordering":
+		return fmt.Sprintf("static_cast<Ordering>(%s)", raw)
+	case "int32_t":
+		return fmt.Sprintf("sign_extend<%d>(%s)", arg.EncWidth, raw)
+	case "bool":
+		return raw + " != 0"
+	default:
+		return raw
+	}
+}
+
+// cppConditionExpr returns a C++ boolean expression testing the given
+// condition against the value of its argument in "word". Conditions apply
+// to the encoded value, so compressed registers are not offset.
+func cppConditionExpr(cond OperandCondition, size Size) string {
+	arg := cond.Arg.ForSize(size)
+	expr := fmt.Sprintf("raw_%s(word)", arg.FuncName)
+	value := fmt.Sprintf("%d", cond.Value)
+	if arg.IsSigned() {
+		expr = fmt.Sprintf("sign_extend<%d>(%s)", arg.EncWidth, expr)
+	} else {
+		value += "u"
+	}
+	cmp := "=="
+	if cond.NotEqual {
+		cmp = "!="
+	}
+	if cond.Modulus != 0 {
+		return fmt.Sprintf("%s %% %d %s %s", expr, cond.Modulus, cmp, value)
+	}
+	return fmt.Sprintf("%s %s %s", expr, cmp, value)
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// Matches returns true if the given instruction word has all of the fixed
+// bits required by the operation.
+func (op *Operation) Matches(word bits32) bool {
+	return (word & op.Mask) == op.Test
+}
+
+// WidthBytes returns the length in bytes of the instructions that encode
+// the operation.
+func (op *Operation) WidthBytes() int {
+	return instructionLength(op.Test)
+}
+
+// Parcels returns the number of 16-bit parcels in the operation's
+// instruction, which is one for compressed instructions.
+func (op *Operation) Parcels() int {
+	return parcelCount(op.WidthBytes())
+}
+
+// FixedMask returns the mask of bits whose values are fixed by the
+// operation's encoding, which is the same as its Mask.
+func (op *Operation) FixedMask() bits32 {
+	return op.Mask
+}
+
+// OperandMask returns the mask of bits that belong to the operation's
+// operands, as the union of all of the decode steps of its codec's
+// arguments. Arguments whose encoding depends on the base ISA size are
+// taken as encoded under the smallest size the operation belongs to.
+func (op *Operation) OperandMask(isa *ISA) bits32 {
+	var ret bits32
+	for _, argName := range op.Codec.Operands {
+		arg := isa.Argument(argName, op.Standards.MinSize())
+		if arg == nil {
+			continue
+		}
+		ret |= arg.Mask()
+	}
+	return ret
+}
+
+// Specificity returns the number of fixed bits in the operation's encoding,
+// which we use to choose between multiple operations that match the same
+// instruction word, such as a HINT or a pseudo-operation carved out of a
+// more general encoding.
+func (op *Operation) Specificity() int {
+	return bits.OnesCount32(uint32(op.Mask))
+}
+
+// IsHint returns true if the given instruction word, which must already be
+// known to encode the operation under the given base ISA size, is a HINT
+// encoding according to the conditions loaded from the hints file.
+func (op *Operation) IsHint(word bits32, size Size) bool {
+	for _, conds := range op.Hints {
+		match := true
+		for _, cond := range conds {
+			if !cond.Holds(word, size) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid returns true if the given instruction word, which must already be
+// known to encode the operation under the given base ISA size, satisfies
+// all of the operation's operand constraints. Encodings that don't are
+// reserved.
+func (op *Operation) Valid(word bits32, size Size) bool {
+	for _, cond := range op.Constraints {
+		if !cond.Holds(word, size) {
+			return false
+		}
+	}
+	return true
+}
+
+// Holds returns true if the condition is true of the operand value in the
+// given instruction word under the given base ISA size.
+func (cond OperandCondition) Holds(word bits32, size Size) bool {
+	v := cond.Arg.ForSize(size).Decode(word)
+	if cond.Modulus != 0 {
+		v %= cond.Modulus
+	}
+	return (v == cond.Value) != cond.NotEqual
+}
+
+// Decode finds the operation that the given instruction word encodes under
+// the given base ISA size, or returns nil if there is no such operation.
+//
+// If more than one operation matches then the one with the most specific
+// mask wins. If there are multiple equally-specific candidates then the
+// encoding is ambiguous and Decode returns nil. Decode also returns nil if
+// the word violates the winning operation's constraints.
+func (isa *ISA) Decode(word bits32, size Size) *Operation {
+	// The candidates are ordered from most to least specific, so the
+	// first match wins unless the next match is just as specific.
+	var ret *Operation
+	anyStd := size.Any()
+	for _, op := range isa.decodeCandidates(word) {
+		if !op.Standards.Has(anyStd) || !op.Matches(word) {
+			continue
+		}
+		if ret != nil {
+			if op.Specificity() == ret.Specificity() {
+				return nil
+			}
+			break
+		}
+		ret = op
+	}
+	if ret != nil && !ret.Valid(word, size) {
+		return nil
+	}
+	return ret
+}
+
+// Errors that DecodeStream passes to its callback along with instructions
+// that it cannot decode.
+var (
+	errIllegalInstruction = errors.New("illegal instruction")
+	errUnsupportedLength  = errors.New("unsupported instruction length")
+	errTruncated          = errors.New("truncated instruction")
+)
+
+// StreamInstruction is an instruction read by DecodeStream.
+type StreamInstruction struct {
+	// Offset is the position of the first byte of the instruction in the
+	// stream.
+	Offset int64
+
+	// Raw holds the bytes of the instruction as read from the stream. For
+	// an instruction of reserved length it holds only the first parcel,
+	// and for a truncated instruction only the bytes that were present.
+	Raw []byte
+
+	// Word holds the first 32 bits of the instruction, with the upper
+	// parcel set to zero for a compressed instruction.
+	Word bits32
+
+	// Op is the operation that the instruction encodes, or nil if there is
+	// no such operation.
+	Op *Operation
+}
+
+// DecodeStream reads little-endian instructions from r, as found in a flat
+// binary or an ELF .text section, and calls fn with each in turn, decoded
+// under the given base ISA size. It stops at the end of the stream, when fn
+// returns false, or when reading from r fails, in which case it returns the
+// error from r.
+//
+// An instruction that cannot be decoded is passed to fn along with an error
+// describing why. Decoding continues after it where possible: an
+// instruction of reserved length is skipped one parcel at a time, since its
+// real length is unknown, and a truncated instruction ends the stream.
+func (isa *ISA) DecodeStream(r io.Reader, size Size, fn func(inst StreamInstruction, err error) bool) error {
+	var offset int64
+	for {
+		inst := StreamInstruction{
+			Offset: offset,
+			Raw:    make([]byte, parcelBytes),
+		}
+		n, err := io.ReadFull(r, inst.Raw)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err == io.ErrUnexpectedEOF:
+			inst.Raw = inst.Raw[:n]
+			inst.Word = streamWord(inst.Raw)
+			fn(inst, errTruncated)
+			return nil
+		case err != nil:
+			return err
+		}
+
+		inst.Word = streamWord(inst.Raw)
+		length := instructionLength(inst.Word)
+		if length == 0 {
+			offset += parcelBytes
+			if !fn(inst, errUnsupportedLength) {
+				return nil
+			}
+			continue
+		}
+		if length > parcelBytes {
+			inst.Raw = append(inst.Raw, make([]byte, length-parcelBytes)...)
+			n, err := io.ReadFull(r, inst.Raw[parcelBytes:])
+			switch {
+			case err == io.EOF || err == io.ErrUnexpectedEOF:
+				inst.Raw = inst.Raw[:parcelBytes+n]
+				inst.Word = streamWord(inst.Raw)
+				fn(inst, errTruncated)
+				return nil
+			case err != nil:
+				return err
+			}
+			inst.Word = streamWord(inst.Raw)
+		}
+		offset += int64(length)
+
+		var instErr error
+		if length > 4 {
+			instErr = errUnsupportedLength
+		} else if inst.Op = isa.Decode(inst.Word, size); inst.Op == nil {
+			instErr = errIllegalInstruction
+		}
+		if !fn(inst, instErr) {
+			return nil
+		}
+	}
+}
+
+// streamWord returns the first 32 bits of the given little-endian
+// instruction bytes, with any missing bytes taken as zero.
+func streamWord(raw []byte) bits32 {
+	var word bits32
+	for i := 0; i < len(raw) && i < 4; i++ {
+		word |= bits32(raw[i]) << (8 * uint(i))
+	}
+	return word
+}
+
+// decodeCandidates returns the operations that the given instruction word
+// could encode, ordered from most to least specific mask: those of the
+// word's major opcode, or for a word that has no assigned major opcode,
+// such as a compressed instruction, all of the operations that belong to
+// no major opcode.
+func (isa *ISA) decodeCandidates(word bits32) []*Operation {
+	num := bits8(word & 0b1111111)
+	if instructionLength(word) == 4 && isa.MajorOpcodes[num] != nil {
+		return isa.OpsForMajor(num)
+	}
+	var ret []*Operation
+	for i := range isa.Ops {
+		if op := &isa.Ops[i]; op.MajorOpcode == nil {
+			ret = append(ret, op)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Specificity() > ret[j].Specificity()
+	})
+	return ret
+}
+
+// Decode extracts the value of the argument from the given instruction
+// word, sign-extending it if the argument is of a signed type.
+func (arg *Argument) Decode(word bits32) int64 {
+	var raw bits32
+	for _, step := range arg.Decoding {
+		switch {
+		case step.RightShift < 0:
+			raw |= (word & step.Mask) << -step.RightShift
+		default:
+			raw |= (word & step.Mask) >> step.RightShift
+		}
+	}
+	if arg.IsSigned() {
+		shift := 64 - arg.EncWidth
+		return int64(uint64(raw)<<shift) >> shift
+	}
+	return int64(raw)
+}
+
+// Encode is the inverse of Decode, returning the bits that represent the
+// given value in an instruction word. Any bits of the value that cannot be
+// represented by the argument are discarded.
+func (arg *Argument) Encode(v int64) bits32 {
+	raw := bits32(v)
+	var ret bits32
+	for _, step := range arg.Decoding {
+		ret |= step.Invert(raw)
+	}
+	return ret
+}
+
+// IsSigned returns true if the argument's value should be sign-extended
+// after decoding.
+func (arg *Argument) IsSigned() bool {
+	return arg.Type == ArgOffset || arg.Type == ArgSignedImmediate
+}
+
+// IsImmediate returns true if the argument is an immediate value or
+// offset, rather than a register or some other kind of field.
+func (arg *Argument) IsImmediate() bool {
+	switch arg.Type {
+	case ArgOffset, ArgSignedImmediate, ArgUnsignedImmediate:
+		return true
+	default:
+		return false
+	}
+}
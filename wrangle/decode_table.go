@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// decodeTableVersion is the version of the binary decode table format,
+// which must change whenever the format changes incompatibly.
+const decodeTableVersion = 1
+
+// decodeTableMagic begins every binary decode table.
+const decodeTableMagic = "RVDT"
+
+// decodeTableMatcherFilename is the name of the C header, written alongside
+// each binary decode table, that documents the format and implements a
+// generic matcher for it.
+const decodeTableMatcherFilename = "decode_table.h"
+
+// generateBinaryTable writes a compact binary table of the encodings of
+// all operations, for decoders that interpret the table at runtime instead
+// of using generated code, along with a C header that documents the format
+// and implements a matcher for it. The format is described in
+// decodeTableMatcher.
+func generateBinaryTable(filename string, isa *ISA) error {
+	dir := filepath.Dir(filename)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// Each operation name and codec gets an ID that is its index in the
+	// corresponding string table at the end of the blob.
+	kinds := goOpKinds(isa)
+	opIDs := make(map[string]int)
+	for i, op := range kinds {
+		opIDs[op.Name] = i
+	}
+	var codecNames []string
+	codecIDs := make(map[string]int)
+	for _, name := range sortedCodecNames(isa.Codecs) {
+		codecIDs[name] = len(codecNames)
+		codecNames = append(codecNames, name)
+	}
+	if len(kinds) > 0xffff || len(codecNames) > 0xff || len(isa.Ops) > 0xffff {
+		return fmt.Errorf("too many operations or codecs for the decode table format")
+	}
+
+	// Entries are ordered so that a matcher can take the first entry that
+	// matches, as for the generated decoders.
+	ops := make([]*Operation, len(isa.Ops))
+	for i := range isa.Ops {
+		ops[i] = &isa.Ops[i]
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Specificity() > ops[j].Specificity()
+	})
+
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	buf.WriteString(decodeTableMagic)
+	binary.Write(&buf, le, uint16(decodeTableVersion))
+	binary.Write(&buf, le, uint16(len(ops)))
+	binary.Write(&buf, le, uint16(len(kinds)))
+	binary.Write(&buf, le, uint16(len(codecNames)))
+	for _, op := range ops {
+		var bases uint8
+		for i, size := range []Size{RV32, RV64, RV128} {
+			if op.Standards.Has(size.Any()) {
+				bases |= 1 << uint(i)
+			}
+		}
+		binary.Write(&buf, le, uint32(op.Mask))
+		binary.Write(&buf, le, uint32(op.Test))
+		binary.Write(&buf, le, uint16(opIDs[op.Name]))
+		buf.WriteByte(uint8(codecIDs[op.Codec.Name]))
+		buf.WriteByte(bases)
+	}
+	for _, op := range kinds {
+		buf.WriteString(op.Name)
+		buf.WriteByte(0)
+	}
+	for _, name := range codecNames {
+		buf.WriteString(name)
+		buf.WriteByte(0)
+	}
+
+	w, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	w.Write(buf.Bytes())
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	hw, err := createOutputFile(filepath.Join(dir, decodeTableMatcherFilename))
+	if err != nil {
+		return err
+	}
+	defer hw.Close()
+	writeFileHeader(hw, cppComments)
+	fmt.Fprintf(hw, decodeTableMatcher, decodeTableVersion)
+	return hw.Close()
+}
+
+// decodeTableMatcher is the C header written alongside a binary decode
+// table. It is a format string whose only verb is the format version.
+const decodeTableMatcher = `// Binary decode table for RISC-V operations, format version %[1]d.
+//
+// All integers are little-endian. The table begins with a 12-byte header:
+//
+//   offset  size  field
+//   0       4     magic "RVDT"
+//   4       2     format version
+//   6       2     number of entries, N
+//   8       2     number of operation names, O
+//   10      2     number of codec names, C
+//
+// followed by N 12-byte entries:
+//
+//   offset  size  field
+//   0       4     mask of the bits that identify the operation
+//   4       4     required values of those bits
+//   8       2     operation ID, an index into the operation names
+//   10      1     codec ID, an index into the codec names
+//   11      1     base ISAs with the operation: bit 0 RV32, 1 RV64, 2 RV128
+//
+// followed by O operation names and then C codec names, each terminated by
+// a NUL byte.
+//
+// The entries are ordered from most to least specific, so the first entry
+// whose mask and test match an instruction word identifies its operation.
+// Compressed instruction words must have their upper 16 bits set to zero.
+// Operand constraints are not represented, so reserved encodings decode as
+// the operation they would otherwise belong to.
+
+#pragma once
+
+#include <stdint.h>
+
+#define RVDT_VERSION %[1]d
+#define RVDT_RV32 1
+#define RVDT_RV64 2
+#define RVDT_RV128 4
+
+static inline uint32_t rvdt_u32(const uint8_t *p) {
+    return (uint32_t)p[0] | (uint32_t)p[1] << 8 | (uint32_t)p[2] << 16 | (uint32_t)p[3] << 24;
+}
+
+static inline uint16_t rvdt_u16(const uint8_t *p) {
+    return (uint16_t)(p[0] | p[1] << 8);
+}
+
+// rvdt_decode returns the ID of the operation that the given instruction
+// word encodes under the given base ISA, which is one of the RVDT_RV
+// constants, or -1 if it matches no operation or the table is of an
+// unsupported version.
+static inline int rvdt_decode(const uint8_t *table, uint32_t word, unsigned base) {
+    if (table[0] != 'R' || table[1] != 'V' || table[2] != 'D' || table[3] != 'T' ||
+        rvdt_u16(table + 4) != RVDT_VERSION) {
+        return -1;
+    }
+    uint16_t count = rvdt_u16(table + 6);
+    const uint8_t *entry = table + 12;
+    for (uint16_t i = 0; i < count; i++, entry += 12) {
+        if ((entry[11] & base) != 0 && (word & rvdt_u32(entry)) == rvdt_u32(entry + 4)) {
+            return rvdt_u16(entry + 8);
+        }
+    }
+    return -1;
+}
+`
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecodeShiftAmountXLEN(t *testing.T) {
+	isa := loadTestISA(t)
+
+	tests := []struct {
+		name      string
+		word      bits32
+		size      Size
+		wantOp    string // empty if the word must not decode
+		wantShamt int64
+	}{
+		{"slli x1, x2, 31 on RV32", 0x01f11093, RV32, "slli", 31},
+		{"slli x1, x2, 31 on RV64", 0x01f11093, RV64, "slli", 31},
+		{"slli x1, x2, 33 on RV64", 0x02111093, RV64, "slli", 33},
+		{"slli x1, x2, 33 on RV32", 0x02111093, RV32, "", 0},
+		{"srai x1, x2, 63 on RV64", 0x43f15093, RV64, "srai", 63},
+		{"srai x1, x2, 63 on RV32", 0x43f15093, RV32, "", 0},
+		{"c.slli x8, 31 on RV32", 0x047e, RV32, "c.slli", 31},
+		{"c.slli x8, 32 on RV64", 0x1402, RV64, "c.slli", 32},
+		{"c.slli x8, 32 on RV32", 0x1402, RV32, "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op := isa.Decode(test.word, test.size)
+			if test.wantOp == "" {
+				if op != nil {
+					t.Fatalf("decoded as %s; want no operation", op.Name)
+				}
+				return
+			}
+			if op == nil {
+				t.Fatalf("did not decode; want %s", test.wantOp)
+			}
+			if op.Name != test.wantOp {
+				t.Fatalf("decoded as %s; want %s", op.Name, test.wantOp)
+			}
+
+			var arg *Argument
+			for _, argName := range op.Codec.Operands {
+				if a := isa.Argument(argName, test.size); a.Type == ArgUnsignedImmediate {
+					arg = a
+				}
+			}
+			if arg == nil {
+				t.Fatalf("%s has no shift amount operand", op.Name)
+			}
+			if got := arg.Decode(test.word); got != test.wantShamt {
+				t.Errorf("wrong shift amount %d; want %d", got, test.wantShamt)
+			}
+		})
+	}
+}
+
+func TestDecodeMostSpecific(t *testing.T) {
+	isa := loadTestISA(t)
+
+	// Each word matches both operations, but the first has the more
+	// specific mask and so must win.
+	tests := []struct {
+		word          bits32
+		want, general string
+	}{
+		{0x0001, "c.nop", "c.addi"},
+		{0x6105, "c.addi16sp", "c.lui"},
+		{0x9002, "c.ebreak", "c.add"},
+		{0x9082, "c.jalr", "c.add"},
+		{0x8082, "c.jr", "c.mv"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			general := findTestOp(isa, test.general)
+			if general == nil {
+				t.Fatalf("no operation %s", test.general)
+			}
+			if !general.Matches(test.word) {
+				t.Fatalf("%s doesn't match 0x%04x, so it doesn't overlap %s", test.general, uint32(test.word), test.want)
+			}
+
+			for _, size := range []Size{RV32, RV64} {
+				op := isa.Decode(test.word, size)
+				if op == nil {
+					t.Fatalf("0x%04x did not decode under RV%d; want %s", uint32(test.word), int(size), test.want)
+				}
+				if op.Name != test.want {
+					t.Errorf("0x%04x decoded as %s under RV%d; want %s", uint32(test.word), op.Name, int(size), test.want)
+				}
+			}
+		})
+	}
+
+	// Words that only the general operation matches must still decode as
+	// that operation.
+	generalTests := []struct {
+		word bits32
+		want string
+	}{
+		{0x0505, "c.addi"},
+		{0x6505, "c.lui"},
+		{0x952e, "c.add"},
+		{0x852e, "c.mv"},
+	}
+	for _, test := range generalTests {
+		op := isa.Decode(test.word, RV32)
+		if op == nil {
+			t.Errorf("0x%04x did not decode; want %s", uint32(test.word), test.want)
+		} else if op.Name != test.want {
+			t.Errorf("0x%04x decoded as %s; want %s", uint32(test.word), op.Name, test.want)
+		}
+	}
+}
+
+func TestDecodeReserved(t *testing.T) {
+	isa := loadTestISA(t)
+
+	// Each word violates the operand constraints of the operation whose
+	// encoding it matches, so it is reserved and doesn't decode at all,
+	// even where a less specific operation also matches it.
+	tests := []struct {
+		word  bits32
+		op    string
+		valid bits32
+	}{
+		{0x4002, "c.lwsp", 0x4502},     // rd=0; c.lwsp a0, 0(sp) is valid
+		{0x0008, "c.addi4spn", 0x1008}, // nzuimm=0
+		{0x6501, "c.lui", 0x6505},      // nzimm=0
+		{0x8002, "c.jr", 0x8082},       // rs1=0, which c.mv also matches
+	}
+	for _, test := range tests {
+		t.Run(test.op, func(t *testing.T) {
+			op := findTestOp(isa, test.op)
+			if op == nil {
+				t.Fatalf("no operation %s", test.op)
+			}
+			if !op.Matches(test.word) {
+				t.Fatalf("%s doesn't match 0x%04x", test.op, uint32(test.word))
+			}
+			if op.Valid(test.word, RV32) {
+				t.Errorf("0x%04x satisfies the constraints of %s", uint32(test.word), test.op)
+			}
+			if got := isa.Decode(test.word, RV32); got != nil {
+				t.Errorf("0x%04x decoded as %s; want nil", uint32(test.word), got.Name)
+			}
+
+			if got := isa.Decode(test.valid, RV32); got == nil || got.Name != test.op {
+				t.Errorf("0x%04x did not decode as %s", uint32(test.valid), test.op)
+			}
+		})
+	}
+}
+
+func TestArgumentSignAndScale(t *testing.T) {
+	tests := []struct {
+		name       string
+		encoding   string
+		typ        ArgType
+		wantSigned bool
+		wantScale  int
+	}{
+		{"sbimm12", "31:25[12|10:5],11:7[4:1|11]", ArgOffset, true, 1},
+		{"jimm20", "31:12[20|10:1|11|19:12]", ArgOffset, true, 1},
+		{"imm12", "31:20[11:0]", ArgSignedImmediate, true, 0},
+		{"zimm", "19:15[4:0]", ArgUnsignedImmediate, false, 0},
+		{"cimmlwsp", "12[5],6:2[4:2|7:6]", ArgUnsignedImmediate, false, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoding, encWidth := ParseArgDecodeSteps(test.encoding)
+			arg := &Argument{
+				Name:     test.name,
+				Type:     test.typ,
+				EncWidth: encWidth,
+				Decoding: decoding,
+			}
+			if got := arg.IsSigned(); got != test.wantSigned {
+				t.Errorf("IsSigned() = %t; want %t", got, test.wantSigned)
+			}
+			if got := arg.Scale(); got != test.wantScale {
+				t.Errorf("Scale() = %d; want %d", got, test.wantScale)
+			}
+
+			// The most negative value, or the largest unsigned value, must
+			// survive a round trip through the encoding.
+			want := int64(-1) << uint(encWidth-1)
+			if !test.wantSigned {
+				want = int64(1)<<uint(encWidth) - 1
+			}
+			want &^= int64(1)<<uint(test.wantScale) - 1
+			if got := arg.Decode(arg.Encode(want)); got != want {
+				t.Errorf("Decode(Encode(%d)) = %d", want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	isa := loadTestISA(t)
+
+	data := []byte{
+		0x13, 0x05, 0x10, 0x00, // addi a0, zero, 1
+		0x2e, 0x85, // c.mv a0, a1
+		0x03, 0x70, 0x00, 0x00, // LOAD with reserved funct3
+		0x1f, 0x00, 0x00, 0x00, 0x00, 0x00, // 48-bit instruction
+		0x7f, 0x70, // reserved length, skipped one parcel at a time
+		0x13, 0x05, 0x10, // truncated addi
+	}
+	type result struct {
+		Offset int64
+		Len    int
+		Word   bits32
+		Op     string
+		Err    error
+	}
+	want := []result{
+		{0, 4, 0x00100513, "addi", nil},
+		{4, 2, 0x852e, "c.mv", nil},
+		{6, 4, 0x00007003, "", errIllegalInstruction},
+		{10, 6, 0x0000001f, "", errUnsupportedLength},
+		{16, 2, 0x707f, "", errUnsupportedLength},
+		{18, 3, 0x100513, "", errTruncated},
+	}
+
+	var got []result
+	err := isa.DecodeStream(bytes.NewReader(data), RV64, func(inst StreamInstruction, err error) bool {
+		r := result{inst.Offset, len(inst.Raw), inst.Word, "", err}
+		if inst.Op != nil {
+			r.Op = inst.Op.Name
+		}
+		got = append(got, r)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong instructions\ngot:  %+v\nwant: %+v", got, want)
+	}
+
+	// Returning false from the callback stops decoding.
+	calls := 0
+	isa.DecodeStream(bytes.NewReader(data), RV64, func(inst StreamInstruction, err error) bool {
+		calls++
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("callback was called %d times after returning false; want 1", calls)
+	}
+
+	// An error from the reader is returned rather than passed to the
+	// callback.
+	readErr := errors.New("read failed")
+	r := io.MultiReader(bytes.NewReader(data[:4]), iotest.ErrReader(readErr))
+	err = isa.DecodeStream(r, RV64, func(inst StreamInstruction, err error) bool {
+		if err != nil {
+			t.Errorf("callback got error %q", err)
+		}
+		return true
+	})
+	if err != readErr {
+		t.Errorf("wrong error %v; want %v", err, readErr)
+	}
+}
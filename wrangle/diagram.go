@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// encodingField is a run of consecutive bits in an instruction encoding
+// that all have the same role: either fixed by the operation, belonging to
+// a particular portion of an operand, or neither.
+type encodingField struct {
+	Hi, Lo int
+	Label  string
+	Fixed  bool
+}
+
+// encodingFields partitions the bits of the given operation's encoding into
+// fields, ordered from the most significant bit to the least.
+func encodingFields(isa *ISA, op *Operation) []encodingField {
+	type owner struct {
+		arg  *Argument
+		step int
+	}
+	width := op.WidthBytes() * 8
+
+	ownerOf := func(pos int) owner {
+		bit := bits32(1) << pos
+		if op.Mask&bit != 0 {
+			return owner{step: -1}
+		}
+		for _, argName := range op.Codec.Operands {
+			arg := isa.Argument(argName, op.Standards.MinSize())
+			if arg == nil {
+				continue
+			}
+			for i, step := range arg.Decoding {
+				if step.Mask&bit != 0 {
+					return owner{arg, i}
+				}
+			}
+		}
+		return owner{step: -2}
+	}
+
+	var ret []encodingField
+	for hi := width - 1; hi >= 0; {
+		own := ownerOf(hi)
+		lo := hi
+		for lo > 0 && ownerOf(lo-1) == own {
+			lo--
+		}
+
+		field := encodingField{Hi: hi, Lo: lo}
+		switch {
+		case own.arg != nil:
+			field.Label = own.arg.Name
+			if len(own.arg.Decoding) > 1 {
+				shift := own.arg.Decoding[own.step].RightShift
+				if hi == lo {
+					field.Label += fmt.Sprintf("[%d]", hi-shift)
+				} else {
+					field.Label += fmt.Sprintf("[%d:%d]", hi-shift, lo-shift)
+				}
+			}
+		case own.step == -1:
+			field.Fixed = true
+			field.Label = fmt.Sprintf("%0*b", hi-lo+1, (op.Test>>lo)&bits32(rangeMask(uint(hi-lo), 0)))
+		default:
+			field.Label = strings.Repeat("-", hi-lo+1)
+		}
+		ret = append(ret, field)
+		hi = lo - 1
+	}
+	return ret
+}
+
+// EncodingString renders the operation's encoding in the style of the
+// RISC-V manual's instruction tables, as its fields from the most
+// significant bit to the least separated by " | ": each operand field as
+// the operand's name and each fixed field as its required binary value.
+// Fixed bits of standard-length instructions are split at the boundaries
+// of the fields of the operation's format, such as funct3 and opcode, as
+// in the manual.
+func (op *Operation) EncodingString(isa *ISA) string {
+	var parts []string
+	for _, field := range encodingFields(isa, op) {
+		if !field.Fixed || op.Parcels() == 1 {
+			parts = append(parts, field.Label)
+			continue
+		}
+		hi := field.Hi
+		for pos := field.Hi; pos >= field.Lo; pos-- {
+			if pos != field.Lo && !op.isFixedFieldBoundary(pos) {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("%0*b", hi-pos+1, (op.Test>>pos)&bits32(rangeMask(uint(hi-pos), 0))))
+			hi = pos - 1
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// isFixedFieldBoundary returns true if the given bit is the lowest bit of
+// one of the fields in fixedFields that the operation's format has. Only
+// the R-type formats have funct7, whose bits the other formats use for
+// immediates.
+func (op *Operation) isFixedFieldBoundary(pos int) bool {
+	rType := strings.HasPrefix(op.Codec.Name, "r")
+	for _, field := range fixedFields {
+		if field.Name == "funct7" && !rType {
+			continue
+		}
+		if int(field.Lo) == pos {
+			return true
+		}
+	}
+	return false
+}
+
+func generateEncodingDiagrams(dir string, isa *ISA, format string) error {
+	var write func(io.Writer, *ISA, *Operation)
+	var ext string
+	switch format {
+	case "ascii":
+		write = writeASCIIDiagram
+		ext = ".txt"
+	case "svg":
+		write = writeSVGDiagram
+		ext = ".svg"
+	default:
+		return fmt.Errorf("unsupported diagram format %q", format)
+	}
+
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// Some operations have a different encoding for each base ISA size,
+	// so we'll disambiguate those by the smallest size they belong to.
+	counts := make(map[string]int)
+	for _, op := range isa.Ops {
+		counts[op.Name]++
+	}
+
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		name := op.FuncName
+		if counts[op.Name] > 1 {
+			name = fmt.Sprintf("%s_rv%d", name, int(op.Standards.MinSize()))
+		}
+
+		w, err := createOutputFile(filepath.Join(dir, name+ext))
+		if err != nil {
+			return err
+		}
+		write(w, isa, op)
+		err = w.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeASCIIDiagram(w io.Writer, isa *ISA, op *Operation) {
+	fields := encodingFields(isa, op)
+
+	var nums, border, labels strings.Builder
+	for _, field := range fields {
+		hi := fmt.Sprintf("%d", field.Hi)
+		lo := fmt.Sprintf("%d", field.Lo)
+		width := len(field.Label) + 2
+		if field.Hi == field.Lo {
+			lo = ""
+		}
+		if min := len(hi) + len(lo) + 2; width < min {
+			width = min
+		}
+
+		nums.WriteString(" " + hi + strings.Repeat(" ", width-len(hi)-len(lo)) + lo)
+		border.WriteString("+" + strings.Repeat("-", width))
+		pad := width - len(field.Label)
+		labels.WriteString("|" + strings.Repeat(" ", pad/2) + field.Label + strings.Repeat(" ", pad-pad/2))
+	}
+
+	if op.FullName != "" {
+		fmt.Fprintf(w, "%s: %s\n\n", op.Name, op.FullName)
+	} else {
+		fmt.Fprintf(w, "%s\n\n", op.Name)
+	}
+	fmt.Fprintln(w, nums.String())
+	fmt.Fprintln(w, border.String()+"+")
+	fmt.Fprintln(w, labels.String()+"|")
+	fmt.Fprintln(w, border.String()+"+")
+}
+
+func writeSVGDiagram(w io.Writer, isa *ISA, op *Operation) {
+	const bitWidth = 24
+	const height = 32
+	const top = 36
+
+	fields := encodingFields(isa, op)
+	width := op.WidthBytes() * 8
+
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"12\">\n", width*bitWidth+2, top+height+2)
+	fmt.Fprintf(w, "  <title>%s: %s</title>\n", html.EscapeString(op.Name), html.EscapeString(op.DocText()))
+	fmt.Fprintf(w, "  <text x=\"1\" y=\"12\">%s</text>\n", html.EscapeString(op.Name))
+	for _, field := range fields {
+		x := (width-1-field.Hi)*bitWidth + 1
+		fieldWidth := (field.Hi - field.Lo + 1) * bitWidth
+		fill := "#ffffff"
+		if field.Fixed {
+			fill = "#e0e0e0"
+		}
+		fmt.Fprintf(w, "  <rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"#000000\"/>\n", x, top, fieldWidth, height, fill)
+		fmt.Fprintf(w, "  <text x=\"%d\" y=\"%d\" text-anchor=\"middle\">%s</text>\n", x+fieldWidth/2, top+height/2+4, html.EscapeString(field.Label))
+		fmt.Fprintf(w, "  <text x=\"%d\" y=\"%d\" text-anchor=\"start\">%d</text>\n", x+2, top-4, field.Hi)
+		if field.Hi != field.Lo {
+			fmt.Fprintf(w, "  <text x=\"%d\" y=\"%d\" text-anchor=\"end\">%d</text>\n", x+fieldWidth-2, top-4, field.Lo)
+		}
+	}
+	fmt.Fprintln(w, "</svg>")
+}
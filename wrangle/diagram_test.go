@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSVGDiagramTitle(t *testing.T) {
+	isa := loadTestISA(t)
+	op := findTestOp(isa, "addi")
+	if op == nil {
+		t.Fatal("no operation addi")
+	}
+	undocumented := *op
+	undocumented.FullName = ""
+	undocumented.Description = ""
+
+	var buf bytes.Buffer
+	writeSVGDiagram(&buf, isa, &undocumented)
+	if want := "<title>addi: The ADDI instruction.</title>"; !strings.Contains(buf.String(), want) {
+		t.Errorf("diagram does not contain %q:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// instructionLength returns the length in bytes of the instruction whose
+// first parcel is given, using the variable-length encoding scheme from
+// the base ISA specification. It returns zero for the encodings reserved
+// for instructions of 192 bits or more.
+func instructionLength(word bits32) int {
+	switch {
+	case (word & 0b11) != 0b11:
+		return 2
+	case (word & 0b11100) != 0b11100:
+		return 4
+	case (word & 0b111111) == 0b011111:
+		return 6
+	case (word & 0b1111111) == 0b0111111:
+		return 8
+	default:
+		nnn := int(word>>12) & 0b111
+		if nnn == 0b111 {
+			return 0
+		}
+		return 10 + 2*nnn
+	}
+}
+
+// formatInstruction renders a decoded instruction word as a mnemonic
+// followed by its operands in codec order, decoding them as for the given
+// base ISA size. A memory ordering operand is written as a suffix on the
+// mnemonic instead, as in "lr.w.aq". Operands whose roles are all taken by
+// implicit operands are omitted, and a return from a subroutine is written
+// as "ret".
+func formatInstruction(isa *ISA, op *Operation, word bits32, size Size) string {
+	if isReturn(isa, op, word, size) {
+		return renderMnemonic("ret", mnemonicStyle)
+	}
+	name := op.Name
+	var operands []string
+	for _, argName := range op.Codec.Operands {
+		arg := isa.Argument(argName, size)
+		if arg.Type == ArgOrdering {
+			name += orderingSuffixes[arg.Decode(word)&0b11]
+			continue
+		}
+		if isImplicitArg(op, arg) {
+			continue
+		}
+		operands = append(operands, formatOperand(isa, arg, arg.Decode(word)))
+	}
+	name = renderMnemonic(name, mnemonicStyle)
+	if len(operands) == 0 {
+		return name
+	}
+	return name + " " + strings.Join(operands, ", ")
+}
+
+// operandRoles returns the roles, as used for implicit operands, of the
+// register operand of the given name: "rd" for crd, say, or both "rs1" and
+// "rd" for crs1rd. It returns nil for operands that aren't registers.
+func operandRoles(argName string) []string {
+	name := strings.TrimPrefix(argName, "c")
+	name = strings.TrimPrefix(name, "f")
+	name = strings.TrimRight(name, "q0")
+	switch name {
+	case "rd", "rs1", "rs2", "rs3":
+		return []string{name}
+	case "rs1rd":
+		return []string{"rs1", "rd"}
+	default:
+		return nil
+	}
+}
+
+// isImplicitArg returns true if every role of the given operand is taken
+// by one of the operation's implicit operands, in which case the operand's
+// encoded value is irrelevant.
+func isImplicitArg(op *Operation, arg *Argument) bool {
+	roles := operandRoles(arg.Name)
+	if len(roles) == 0 {
+		return false
+	}
+	for _, role := range roles {
+		if _, ok := op.ImplicitReg(role); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// isReturn returns true if the instruction is a return from a subroutine:
+// a jump to the address in ra with no offset that discards the link
+// address, whether explicitly or through implicit operands.
+func isReturn(isa *ISA, op *Operation, word bits32, size Size) bool {
+	if op.Category(isa) != "jump" {
+		return false
+	}
+	regs := make(map[string]int)
+	for _, argName := range op.Codec.Operands {
+		arg := isa.Argument(argName, size)
+		v := arg.Decode(word)
+		switch {
+		case arg.Type == ArgIntReg:
+		case arg.Type == ArgCompressedReg && !strings.HasPrefix(arg.Name, "cf"):
+			v += 8
+		case v != 0:
+			return false
+		default:
+			continue
+		}
+		for _, role := range operandRoles(arg.Name) {
+			regs[role] = int(v)
+		}
+	}
+	for _, imp := range op.Implicit {
+		regs[imp.Role] = imp.Reg
+	}
+	rd, hasRD := regs["rd"]
+	rs1, hasRS1 := regs["rs1"]
+	return hasRD && hasRS1 && rd == 0 && rs1 == 1
+}
+
+// orderingSuffixes are the mnemonic suffixes for each value of the combined
+// aq and rl bits.
+var orderingSuffixes = [...]string{"", ".rl", ".aq", ".aqrl"}
+
+func formatOperand(isa *ISA, arg *Argument, v int64) string {
+	abi := *regNames == "abi"
+	switch arg.Type {
+	case ArgIntReg, ArgFloatReg:
+		return isa.RegisterName(arg.Type, int(v), abi)
+	case ArgCompressedReg:
+		// Compressed register fields select from only the eight most
+		// commonly-used registers, starting at x8 (or f8). The operands
+		// file doesn't distinguish integer from float, so we use the
+		// naming convention of the arguments themselves.
+		if strings.HasPrefix(arg.Name, "cf") {
+			return isa.RegisterName(ArgFloatReg, int(v+8), abi)
+		}
+		return isa.RegisterName(ArgIntReg, int(v+8), abi)
+	default:
+		return fmt.Sprintf("%d", v)
+	}
+}
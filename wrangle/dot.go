@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// generateDecodeTreeDot writes a Graphviz graph showing how a decoder can
+// partition the coding space: first by major opcode, and then by the
+// funct3 and funct7 fields where the operations fix them. Operations that
+// share a parent node can be distinguished only by other bits, so large
+// groups of leaves indicate where a decoder must do more work.
+func generateDecodeTreeDot(filename string, isa *ISA) error {
+	err := os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	w, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	const funct3Mask = bits32(0b111 << 12)
+	const funct7Mask = bits32(0b1111111 << 25)
+
+	nextID := 0
+	node := func(label string, attrs string) string {
+		id := fmt.Sprintf("n%d", nextID)
+		nextID++
+		fmt.Fprintf(w, "  %s [label=%q%s];\n", id, label, attrs)
+		return id
+	}
+	edge := func(from, to, label string) {
+		fmt.Fprintf(w, "  %s -> %s [label=%q];\n", from, to, label)
+	}
+	leaf := func(parent string, op *Operation, label string) {
+		// The base ISA entries in the standards are redundant with the
+		// extension-specific ones, so we'll leave them out of the label.
+		var stds []Standard
+		for std := range op.Standards {
+			if std.Extension() != ExtInvalid {
+				stds = append(stds, std)
+			}
+		}
+		sort.Slice(stds, func(i, j int) bool {
+			return stds[i] < stds[j]
+		})
+		text := op.Name + "\n"
+		for i, std := range stds {
+			if i > 0 {
+				text += " "
+			}
+			text += std.String()
+		}
+		id := node(text, ", shape=box")
+		edge(parent, id, label)
+	}
+
+	writeFileHeader(w, dotComments)
+	w.WriteString("digraph decode {\n")
+	w.WriteString("  rankdir=LR;\n")
+	root := node("opcode[6:0]", "")
+
+	for _, majorOp := range sortedMajorOpcodes(isa.MajorOpcodes) {
+		ops := isa.OpsForMajor(majorOp.Num)
+		if len(ops) == 0 {
+			continue
+		}
+		majorID := node(majorOp.Name, "")
+		edge(root, majorID, fmt.Sprintf("0b%07b", uint8(majorOp.Num)))
+
+		// Operations that don't fix funct3 can only be leaves directly
+		// under the major opcode.
+		byFunct3 := make(map[bits32][]*Operation)
+		var funct3s []int
+		for _, op := range ops {
+			if op.Mask&funct3Mask != funct3Mask {
+				leaf(majorID, op, "")
+				continue
+			}
+			f3 := (op.Test & funct3Mask) >> 12
+			if _, exists := byFunct3[f3]; !exists {
+				funct3s = append(funct3s, int(f3))
+			}
+			byFunct3[f3] = append(byFunct3[f3], op)
+		}
+		sort.Ints(funct3s)
+
+		for _, f3 := range funct3s {
+			group := byFunct3[bits32(f3)]
+			label := fmt.Sprintf("funct3=0b%03b", f3)
+			if len(group) == 1 {
+				leaf(majorID, group[0], label)
+				continue
+			}
+			f3ID := node(fmt.Sprintf("%s\nfunct3=0b%03b", majorOp.Name, f3), "")
+			edge(majorID, f3ID, label)
+			for _, op := range group {
+				if op.Mask&funct7Mask != funct7Mask {
+					leaf(f3ID, op, "")
+					continue
+				}
+				leaf(f3ID, op, fmt.Sprintf("funct7=0b%07b", (op.Test&funct7Mask)>>25))
+			}
+		}
+	}
+
+	// Everything else, including the compressed instructions, has no
+	// major opcode and so must be matched individually.
+	var others []*Operation
+	for i := range isa.Ops {
+		if op := &isa.Ops[i]; op.MajorOpcode == nil {
+			others = append(others, op)
+		}
+	}
+	if len(others) > 0 {
+		otherID := node("(no major opcode)", "")
+		edge(root, otherID, "other")
+		for _, op := range others {
+			leaf(otherID, op, "")
+		}
+	}
+
+	w.WriteString("}\n")
+	return w.Close()
+}
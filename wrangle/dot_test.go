@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateDecodeTreeDotCreatesDir(t *testing.T) {
+	isa := loadTestISA(t)
+	filename := filepath.Join(t.TempDir(), "generated", "decode-tree.dot")
+	if err := generateDecodeTreeDot(filename, isa); err != nil {
+		t.Fatalf("failed to generate: %s", err)
+	}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "digraph") {
+		t.Errorf("output is not a Graphviz digraph:\n%s", src)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// disassembleELF writes a disassembly of each executable section of the
+// given RISC-V ELF file, decoding as the base ISA that matches the file's
+// class. If the file has no section headers, as when they've been
+// stripped, it disassembles the executable segments instead.
+func disassembleELF(w io.Writer, isa *ISA, filename string) error {
+	f, err := elf.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if f.Machine != elf.EM_RISCV {
+		return fmt.Errorf("%s is not a RISC-V ELF file (machine is %s)", filename, f.Machine)
+	}
+	var size Size
+	switch f.Class {
+	case elf.ELFCLASS32:
+		size = RV32
+	case elf.ELFCLASS64:
+		size = RV64
+	default:
+		return fmt.Errorf("%s has unsupported ELF class %s", filename, f.Class)
+	}
+	c := terminalColors(w)
+
+	found := false
+	for _, sect := range f.Sections {
+		if sect.Type != elf.SHT_PROGBITS || sect.Flags&elf.SHF_EXECINSTR == 0 {
+			continue
+		}
+		data, err := sect.Data()
+		if err != nil {
+			return fmt.Errorf("failed to read section %s: %s", sect.Name, err)
+		}
+		fmt.Fprintf(w, "\nDisassembly of section %s:\n\n", sect.Name)
+		disassembleBytes(w, isa, data, sect.Addr, size, c)
+		found = true
+	}
+	if found {
+		return nil
+	}
+
+	for i, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || prog.Flags&elf.PF_X == 0 {
+			continue
+		}
+		data := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(data, 0); err != nil {
+			return fmt.Errorf("failed to read segment %d: %s", i, err)
+		}
+		fmt.Fprintf(w, "\nDisassembly of segment %d:\n\n", i)
+		disassembleBytes(w, isa, data, prog.Vaddr, size, c)
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("%s has no executable sections or segments", filename)
+	}
+	return nil
+}
+
+// disassembleFlat writes a disassembly of the given file as a flat binary
+// of instructions, such as a boot ROM image, which is loaded at the given
+// address and decoded as the given base ISA.
+func disassembleFlat(w io.Writer, isa *ISA, filename string, addr uint64, size Size) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	disassembleBytes(w, isa, data, addr, size, terminalColors(w))
+	return nil
+}
+
+// disassembleBytes writes a line for each of the little-endian
+// instructions in the given data, which begins at the given address, with
+// the address, the raw instruction bits, and the decoded instruction. The
+// addresses are padded to the width of the base ISA's registers.
+// Instructions that don't decode are written as "unknown", as described
+// for DecodeStream.
+func disassembleBytes(w io.Writer, isa *ISA, data []byte, addr uint64, size Size, c colors) {
+	addrDigits := size.Bytes() * 2
+	// Reading from a bytes.Reader can't fail, so there's no error to
+	// handle.
+	isa.DecodeStream(bytes.NewReader(data), size, func(inst StreamInstruction, err error) bool {
+		text := "unknown"
+		switch {
+		case err == errTruncated:
+			text = "(truncated)"
+		case err == nil:
+			text = colorInstruction(formatInstruction(isa, inst.Op, inst.Word, size), c)
+		}
+		fmt.Fprintf(w, "%*x:\t%-8s\t%s\n", addrDigits, addr+uint64(inst.Offset), rawInstructionHex(inst.Raw), text)
+		return true
+	})
+}
+
+// rawInstructionHex renders the given little-endian instruction bytes as
+// hexadecimal parcels, most significant first, as in an objdump listing.
+func rawInstructionHex(raw []byte) string {
+	var parcels []string
+	for i := 0; i < len(raw); i += 2 {
+		if i+1 < len(raw) {
+			parcels = append([]string{fmt.Sprintf("%02x%02x", raw[i+1], raw[i])}, parcels...)
+		} else {
+			parcels = append([]string{fmt.Sprintf("%02x", raw[i])}, parcels...)
+		}
+	}
+	return strings.Join(parcels, "")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDisassembleBytes(t *testing.T) {
+	isa := loadTestISA(t)
+
+	data := []byte{
+		0x13, 0x05, 0x10, 0x00, // addi a0, zero, 1
+		0x2e, 0x85, // c.mv a0, a1
+		0x03, 0x70, 0x00, 0x00, // LOAD with reserved funct3
+		0x7f, 0x70, // reserved length
+		0x13, 0x05, 0x10, // truncated addi
+	}
+	want := "" +
+		"80000000:\t00100513\taddi a0, zero, 1\n" +
+		"80000004:\t852e    \tc.mv a0, a1\n" +
+		"80000006:\t00007003\tunknown\n" +
+		"8000000a:\t707f    \tunknown\n" +
+		"8000000c:\t100513  \t(truncated)\n"
+
+	var buf bytes.Buffer
+	disassembleBytes(&buf, isa, data, 0x80000000, RV32, colors{})
+	if got := buf.String(); got != want {
+		t.Errorf("wrong disassembly\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
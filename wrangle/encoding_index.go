@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// generateEncodingIndex writes a JSON object mapping the canonical
+// encoding of each operation, which is its Test with all operand bits
+// zero, to the operation's name, with one such mapping for each of the RV32
+// and RV64 base ISAs. This is the ground truth for an external decoder
+// test, complementing the test vectors.
+//
+// Where several operations share a canonical encoding, the word maps to
+// whichever of them the word decodes to, and the collision is logged as an
+// ambiguity. If it decodes to none of them then it is omitted.
+func generateEncodingIndex(w io.Writer, isa *ISA) error {
+	ret := make(map[string]map[string]string)
+	for _, size := range []Size{RV32, RV64} {
+		anyStd := size.Any()
+		byTest := make(map[bits32][]*Operation)
+		var tests []bits32
+		for i := range isa.Ops {
+			op := &isa.Ops[i]
+			if !op.Standards.Has(anyStd) {
+				continue
+			}
+			if _, ok := byTest[op.Test]; !ok {
+				tests = append(tests, op.Test)
+			}
+			byTest[op.Test] = append(byTest[op.Test], op)
+		}
+
+		index := make(map[string]string)
+		for _, test := range tests {
+			ops := byTest[test]
+			key := fmt.Sprintf("0x%08x", uint32(test))
+			if len(ops) == 1 {
+				index[key] = ops[0].Name
+				continue
+			}
+
+			names := make([]string, len(ops))
+			for i, op := range ops {
+				names[i] = op.Name
+			}
+			got := isa.Decode(test, size)
+			for _, op := range ops {
+				if op == got {
+					index[key] = op.Name
+				}
+			}
+			if got == nil {
+				log.Printf("warning: %s operations %s share encoding %s, which decodes as none of them", anyStd, strings.Join(names, ", "), key)
+			} else {
+				log.Printf("warning: %s operations %s share encoding %s, which decodes as %s", anyStd, strings.Join(names, ", "), key, got.Name)
+			}
+		}
+		ret[anyStd.String()] = index
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ret)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// errWriter wraps a writer to retain the first error from writing to it,
+// after which all writes are ignored. This allows emitters to write freely
+// and then check Err only once when they are done.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func newErrWriter(w io.Writer) *errWriter {
+	return &errWriter{w: w}
+}
+
+func (ew *errWriter) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n, err := ew.w.Write(p)
+	ew.err = err
+	return n, err
+}
+
+func (ew *errWriter) WriteString(s string) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n, err := io.WriteString(ew.w, s)
+	ew.err = err
+	return n, err
+}
+
+// Printf writes the result of formatting the given arguments.
+func (ew *errWriter) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(ew, format, args...)
+}
+
+// Err returns the first error encountered while writing, if any.
+func (ew *errWriter) Err() error {
+	return ew.err
+}
+
+// Indent adjusts the depth of subsequent lines, if the underlying writer
+// is an indentWriter. See indentWriter.Indent.
+func (ew *errWriter) Indent(levels int) {
+	if iw, ok := ew.w.(*indentWriter); ok {
+		iw.Indent(levels)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingWriter accepts writes until it has been given limit bytes, after
+// which it fails every write, as a full disk would.
+type failingWriter struct {
+	limit   int
+	written int
+	calls   int
+}
+
+var errWriterFull = errors.New("writer is full")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if w.written+len(p) > w.limit {
+		n := w.limit - w.written
+		w.written = w.limit
+		return n, errWriterFull
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestErrWriter(t *testing.T) {
+	fw := &failingWriter{limit: 8}
+	w := newErrWriter(fw)
+
+	w.WriteString("abcd")
+	if err := w.Err(); err != nil {
+		t.Fatalf("unexpected error after a successful write: %s", err)
+	}
+	w.Printf("%s", "efghijkl")
+	w.WriteString("mnop")
+	w.Write([]byte("qrst"))
+
+	if err := w.Err(); err != errWriterFull {
+		t.Fatalf("wrong error %v; want %v", err, errWriterFull)
+	}
+	if fw.calls != 2 {
+		t.Errorf("underlying writer was called %d times; want 2, since writes after the first error must be ignored", fw.calls)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// DecodeOutcome classifies the result of decoding an instruction word, and
+// in particular the reason that a word doesn't decode.
+type DecodeOutcome int
+
+const (
+	// DecodeOK means that the word encodes exactly one operation.
+	DecodeOK DecodeOutcome = iota
+
+	// DecodeUnsupportedLength means that the word belongs to an
+	// instruction longer than 32 bits, none of which are described.
+	DecodeUnsupportedLength
+
+	// DecodeUnknownMajorOpcode means that the opcode field of a
+	// standard-length word doesn't select any assigned major opcode.
+	DecodeUnknownMajorOpcode
+
+	// DecodeNoMatch means that the opcode is known, but none of its
+	// operations match the remaining fixed bits of the word.
+	DecodeNoMatch
+
+	// DecodeAmbiguous means that more than one operation matches the word
+	// equally well.
+	DecodeAmbiguous
+
+	// DecodeReserved means that the word matches an operation but
+	// violates one of its operand constraints.
+	DecodeReserved
+)
+
+func (o DecodeOutcome) String() string {
+	switch o {
+	case DecodeOK:
+		return "ok"
+	case DecodeUnsupportedLength:
+		return "unsupported instruction length"
+	case DecodeUnknownMajorOpcode:
+		return "unknown major opcode"
+	case DecodeNoMatch:
+		return "no operation matches"
+	case DecodeAmbiguous:
+		return "ambiguous encoding"
+	case DecodeReserved:
+		return "reserved encoding"
+	default:
+		return fmt.Sprintf("DecodeOutcome(%d)", int(o))
+	}
+}
+
+// DecodeResult is the result of DecodeExplain.
+type DecodeResult struct {
+	Outcome DecodeOutcome
+
+	// Op is the decoded operation, for DecodeOK, or the operation whose
+	// constraints the word violates, for DecodeReserved.
+	Op *Operation
+
+	// Candidates are the operations that came closest to matching. For
+	// DecodeNoMatch these are the operations sharing the word's major
+	// opcode (or, for compressed instructions, its quadrant and funct3),
+	// ordered by how many of their fixed bits the word disagrees with. For
+	// DecodeAmbiguous they are the operations that match equally well.
+	Candidates []*Operation
+}
+
+// DecodeExplain is like Decode, but also describes why a word that doesn't
+// decode is invalid, as a debugging aid for hand-crafted encodings.
+func (isa *ISA) DecodeExplain(word bits32, size Size) DecodeResult {
+	length := instructionLength(word)
+	if length > 4 || length == 0 {
+		return DecodeResult{Outcome: DecodeUnsupportedLength}
+	}
+	if length == 4 && isa.MajorOpcodes[bits8(word&0b1111111)] == nil {
+		return DecodeResult{Outcome: DecodeUnknownMajorOpcode}
+	}
+
+	anyStd := size.Any()
+	var matches, near []*Operation
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if !op.Standards.Has(anyStd) || op.WidthBytes() != length {
+			continue
+		}
+		if op.Matches(word) {
+			matches = append(matches, op)
+			continue
+		}
+		var group bits32 = 0b1111111
+		if length == 2 {
+			group = 0b1110000000000011
+		}
+		if (op.Test^word)&op.Mask&group == 0 {
+			near = append(near, op)
+		}
+	}
+
+	if len(matches) == 0 {
+		sort.SliceStable(near, func(i, j int) bool {
+			return near[i].Mismatches(word) < near[j].Mismatches(word)
+		})
+		return DecodeResult{Outcome: DecodeNoMatch, Candidates: near}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Specificity() > matches[j].Specificity()
+	})
+	best := matches[0]
+	tied := matches[:1]
+	for _, op := range matches[1:] {
+		if op.Specificity() == best.Specificity() {
+			tied = append(tied, op)
+		}
+	}
+	switch {
+	case len(tied) > 1:
+		return DecodeResult{Outcome: DecodeAmbiguous, Candidates: tied}
+	case !best.Valid(word, size):
+		return DecodeResult{Outcome: DecodeReserved, Op: best}
+	default:
+		return DecodeResult{Outcome: DecodeOK, Op: best}
+	}
+}
+
+// Mismatches returns the number of the operation's fixed bits whose values
+// in the given word differ from the operation's encoding.
+func (op *Operation) Mismatches(word bits32) int {
+	return bits.OnesCount32(uint32((op.Test ^ word) & op.Mask))
+}
+
+func (r DecodeResult) String() string {
+	switch r.Outcome {
+	case DecodeOK:
+		return r.Op.Name
+	case DecodeReserved:
+		return fmt.Sprintf("%s: violates the operand constraints of %s", r.Outcome, r.Op.Name)
+	case DecodeNoMatch, DecodeAmbiguous:
+		if len(r.Candidates) == 0 {
+			return r.Outcome.String()
+		}
+		names := make([]string, len(r.Candidates))
+		for i, op := range r.Candidates {
+			names[i] = op.Name
+		}
+		return fmt.Sprintf("%s: candidates are %s", r.Outcome, strings.Join(names, ", "))
+	default:
+		return r.Outcome.String()
+	}
+}
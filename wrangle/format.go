@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+)
+
+// encodingFormats maps the base types of the standard-length codecs to the
+// names of the instruction formats from the base ISA specification.
+var encodingFormats = map[string]string{
+	"r":  "R",
+	"r4": "R4",
+	"i":  "I",
+	"s":  "S",
+	"sb": "B",
+	"u":  "U",
+	"uj": "J",
+}
+
+// BaseType returns the type of the codec without any subtype or format
+// variant, such as "i" for "i·sh5" or "s" for "s+f".
+func (c *Codec) BaseType() string {
+	if idx := strings.IndexAny(c.Name, "·+"); idx != -1 {
+		return c.Name[:idx]
+	}
+	return c.Name
+}
+
+// ClassifyFormat returns the name of the instruction format of the given
+// instruction word, such as "R" or "I", based only on its opcode. It
+// returns "compressed" for any 16-bit instruction, and "unknown" if the
+// opcode doesn't belong to a major opcode with a known format.
+func (isa *ISA) ClassifyFormat(word bits32) string {
+	switch instructionLength(word) {
+	case 2:
+		return "compressed"
+	case 4:
+		majorOp := isa.MajorOpcodes[bits8(word&0b1111111)]
+		if majorOp == nil {
+			return "unknown"
+		}
+		if format := isa.MajorOpcodeFormat(majorOp); format != "" {
+			return format
+		}
+	}
+	return "unknown"
+}
+
+// MajorOpcodeFormat returns the instruction format used by most of the
+// operations of the given major opcode, or an empty string if none of them
+// use one of the standard formats.
+func (isa *ISA) MajorOpcodeFormat(majorOp *MajorOpcode) string {
+	counts := make(map[string]int)
+	for _, op := range isa.OpsForMajor(majorOp.Num) {
+		if format, ok := encodingFormats[op.Codec.BaseType()]; ok {
+			counts[format]++
+		}
+	}
+
+	// Ties are broken by name, so that the result is deterministic.
+	var ret string
+	for format, count := range counts {
+		if count > counts[ret] || (count == counts[ret] && format < ret) {
+			ret = format
+		}
+	}
+	return ret
+}
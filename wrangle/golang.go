@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const goPackageName = "riscv"
+
+func generateGoFragments(dir string, isa *ISA) ([]string, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name     string
+		generate func(filename string) error
+	}{
+		{"decode.go", func(filename string) error { return generateGoDecode(filename, isa) }},
+		{"raw_instruction.go", func(filename string) error { return generateGoRawInstruction(filename, isa.Arguments) }},
+		{"stream.go", generateGoStream},
+		{"decode_test.go", func(filename string) error { return generateGoDecodeTest(filename, isa) }},
+	}
+	var created []string
+	for _, file := range files {
+		filename := filepath.Join(dir, file.name)
+		if err := file.generate(filename); err != nil {
+			return created, err
+		}
+		created = append(created, filename)
+	}
+	return created, nil
+}
+
+// goOutputFile is a Go source file that is collected in memory and then
+// formatted with go/format when it's closed, so that the output is gofmt
+// clean regardless of how the emitters space it. If the source doesn't
+// parse then the file is not written at all, since that means there's a
+// bug in the emitter.
+type goOutputFile struct {
+	bytes.Buffer
+
+	filename string
+}
+
+func newGoOutputFile(filename string) *goOutputFile {
+	return &goOutputFile{filename: filename}
+}
+
+// Close formats the collected source and writes it to the file.
+func (o *goOutputFile) Close() error {
+	src, err := format.Source(o.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated invalid Go source for %s: %s", o.filename, err)
+	}
+	w, err := createOutputFile(o.filename)
+	if err != nil {
+		return err
+	}
+	w.Write(src)
+	return w.Close()
+}
+
+// goOpKinds returns the distinct operation names in the ISA, each
+// represented by the first operation of that name.
+func goOpKinds(isa *ISA) []*Operation {
+	var ret []*Operation
+	seen := make(map[string]struct{})
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if _, ok := seen[op.Name]; ok {
+			continue
+		}
+		seen[op.Name] = struct{}{}
+		ret = append(ret, op)
+	}
+	return ret
+}
+
+func generateGoDecode(filename string, isa *ISA) error {
+	w := newGoOutputFile(filename)
+
+	writeFileHeader(w, goComments)
+	fmt.Fprintf(w, "package %s\n\n", goPackageName)
+
+	w.WriteString("// Op identifies an operation, independently of its operands.\n")
+	w.WriteString("type Op int\n\n")
+	w.WriteString("const (\n")
+	w.WriteString("\tOpInvalid Op = iota\n")
+	kinds := goOpKinds(isa)
+	for _, op := range kinds {
+		fmt.Fprintf(w, "\tOp%s // %s\n", op.TypeName, op.DocText())
+	}
+	w.WriteString(")\n\n")
+
+	w.WriteString("var opNames = [...]string{\n")
+	w.WriteString("\tOpInvalid: \"invalid\",\n")
+	for _, op := range kinds {
+		fmt.Fprintf(w, "\tOp%s: %q,\n", op.TypeName, renderMnemonic(op.Name, mnemonicStyle))
+	}
+	w.WriteString("}\n\n")
+
+	w.WriteString("// String returns the assembly mnemonic for the operation.\n")
+	w.WriteString("func (op Op) String() string {\n")
+	w.WriteString("\treturn opNames[op]\n")
+	w.WriteString("}\n\n")
+
+	w.WriteString("// Decode returns the operation encoded by the given instruction word\n")
+	w.WriteString("// under the given base ISA width, or OpInvalid if the word is not a\n")
+	w.WriteString("// valid instruction. Compressed instructions must have the upper\n")
+	w.WriteString("// parcel set to zero.\n")
+	w.WriteString("func Decode(word uint32, xlen int) Op {\n")
+	w.WriteString("\tswitch xlen {\n")
+	for _, size := range []Size{RV32, RV64} {
+		fmt.Fprintf(w, "\tcase %d:\n", int(size))
+		fmt.Fprintf(w, "\t\treturn decodeRV%d(word)\n", int(size))
+	}
+	w.WriteString("\tdefault:\n")
+	w.WriteString("\t\treturn OpInvalid\n")
+	w.WriteString("\t}\n")
+	w.WriteString("}\n")
+
+	for _, size := range []Size{RV32, RV64} {
+		anyStd := size.Any()
+		var ops []*Operation
+		for i := range isa.Ops {
+			if op := &isa.Ops[i]; op.Standards.Has(anyStd) {
+				ops = append(ops, op)
+			}
+		}
+
+		// Testing the most specific encodings first means that each word
+		// decodes to the operation that has the most fixed bits in common
+		// with it, in the same way as ISA.Decode.
+		sort.SliceStable(ops, func(i, j int) bool {
+			return ops[i].Specificity() > ops[j].Specificity()
+		})
+
+		fmt.Fprintf(w, "\nfunc decodeRV%d(word uint32) Op {\n", int(size))
+		w.WriteString("\tswitch {\n")
+		for _, op := range ops {
+			fmt.Fprintf(w, "\tcase word&0x%08x == 0x%08x:\n", uint32(op.Mask), uint32(op.Test))
+			fmt.Fprintf(w, "\t\treturn Op%s\n", op.TypeName)
+		}
+		w.WriteString("\tdefault:\n")
+		w.WriteString("\t\treturn OpInvalid\n")
+		w.WriteString("\t}\n")
+		w.WriteString("}\n")
+	}
+
+	return w.Close()
+}
+
+func generateGoRawInstruction(filename string, args map[string]*Argument) error {
+	w := newGoOutputFile(filename)
+
+	writeFileHeader(w, goComments)
+	fmt.Fprintf(w, "package %s\n\n", goPackageName)
+
+	w.WriteString("// Masks for the bits of each operand in an instruction word.\n")
+	w.WriteString("const (\n")
+	for _, arg := range sortedArgEncodings(args) {
+		for i, step := range arg.Decoding {
+			fmt.Fprintf(w, "\t%s = 0x%08x // %s\n", arg.MaskConstName(i, NamePascal), uint32(step.Mask), step.Describe(arg.Name))
+		}
+	}
+	w.WriteString(")\n\n")
+
+	w.WriteString("// RawInstruction is a raw RISC-V instruction word that is yet to be decoded.\n")
+	w.WriteString("type RawInstruction uint32\n")
+	for _, field := range fixedFields {
+		name := makeIdentTitle(field.Name)
+		w.WriteString("\n")
+		fmt.Fprintf(w, "// %s returns the raw value of bits %d:%d, regardless of encoding.\n", name, field.Hi, field.Lo)
+		fmt.Fprintf(w, "func (raw RawInstruction) %s() uint32 {\n", name)
+		fmt.Fprintf(w, "\treturn (uint32(raw) >> %d) & 0x%x\n", field.Lo, uint32(rangeMask(field.Hi-field.Lo, 0)))
+		w.WriteString("}\n")
+	}
+
+	return w.Close()
+}
+
+// generateGoStream writes DecodeStream, which decodes a sequence of
+// instructions read from an io.Reader. It uses a callback rather than an
+// iterator so that the package doesn't require a recent Go version.
+func generateGoStream(filename string) error {
+	w := newGoOutputFile(filename)
+
+	writeFileHeader(w, goComments)
+	fmt.Fprintf(w, "package %s\n\n", goPackageName)
+	w.WriteString(goStreamSource)
+
+	return w.Close()
+}
+
+// goStreamSource is the body of the file that generateGoStream writes,
+// which doesn't depend on the ISA.
+const goStreamSource = `import (
+	"errors"
+	"io"
+)
+
+// Errors that DecodeStream passes to its callback along with instructions
+// that it cannot decode.
+var (
+	// ErrIllegalInstruction means that the instruction does not encode any
+	// known operation.
+	ErrIllegalInstruction = errors.New("illegal instruction")
+
+	// ErrUnsupportedLength means that the instruction is longer than 32
+	// bits, which no known operation is, or that its length is reserved.
+	ErrUnsupportedLength = errors.New("unsupported instruction length")
+
+	// ErrTruncated means that the stream ended partway through the
+	// instruction.
+	ErrTruncated = errors.New("truncated instruction")
+)
+
+// Instruction is an instruction read by DecodeStream.
+type Instruction struct {
+	// Offset is the position of the first byte of the instruction in the
+	// stream.
+	Offset int64
+
+	// Word holds the first 32 bits of the instruction, with the upper
+	// parcel set to zero for a compressed instruction.
+	Word uint32
+
+	// Len is the length of the instruction in bytes, or zero if it could
+	// not be determined.
+	Len int
+
+	// Op is the operation that the instruction encodes, or OpInvalid.
+	Op Op
+}
+
+// InstructionLength returns the length in bytes of the instruction whose
+// first 16-bit parcel is given, or zero if the encoding is reserved for
+// instructions of 192 bits or longer.
+func InstructionLength(parcel uint16) int {
+	switch {
+	case parcel&0b11 != 0b11:
+		return 2
+	case parcel&0b11100 != 0b11100:
+		return 4
+	case parcel&0b111111 == 0b011111:
+		return 6
+	case parcel&0b1111111 == 0b0111111:
+		return 8
+	default:
+		nnn := int(parcel>>12) & 0b111
+		if nnn == 0b111 {
+			return 0
+		}
+		return 10 + 2*nnn
+	}
+}
+
+// DecodeStream reads little-endian instructions from r, as found in a flat
+// binary or an ELF .text section, and calls fn with each in turn, decoded
+// under the given base ISA width. It stops at the end of the stream, when
+// fn returns false, or when reading from r fails, in which case it returns
+// the error from r.
+//
+// An instruction that cannot be decoded is passed to fn along with one of
+// the errors declared in this package, and decoding continues after it
+// where possible. A truncated instruction, or one of reserved length,
+// ends the stream because the start of the next instruction is unknown.
+func DecodeStream(r io.Reader, xlen int, fn func(inst Instruction, err error) bool) error {
+	var buf [2]byte
+	var offset int64
+	for {
+		_, err := io.ReadFull(r, buf[:])
+		switch {
+		case err == io.EOF:
+			return nil
+		case err == io.ErrUnexpectedEOF:
+			fn(Instruction{Offset: offset, Word: uint32(buf[0])}, ErrTruncated)
+			return nil
+		case err != nil:
+			return err
+		}
+		parcel := uint16(buf[0]) | uint16(buf[1])<<8
+		inst := Instruction{
+			Offset: offset,
+			Word:   uint32(parcel),
+			Len:    InstructionLength(parcel),
+		}
+		if inst.Len == 0 {
+			fn(inst, ErrUnsupportedLength)
+			return nil
+		}
+
+		for read := 2; read < inst.Len; read += 2 {
+			_, err = io.ReadFull(r, buf[:])
+			switch {
+			case err == io.EOF || err == io.ErrUnexpectedEOF:
+				fn(inst, ErrTruncated)
+				return nil
+			case err != nil:
+				return err
+			}
+			if read == 2 {
+				inst.Word |= (uint32(buf[0]) | uint32(buf[1])<<8) << 16
+			}
+		}
+		offset += int64(inst.Len)
+
+		var instErr error
+		if inst.Len > 4 {
+			instErr = ErrUnsupportedLength
+		} else if inst.Op = Decode(inst.Word, xlen); inst.Op == OpInvalid {
+			instErr = ErrIllegalInstruction
+		}
+		if !fn(inst, instErr) {
+			return nil
+		}
+	}
+}
+`
+
+func generateGoDecodeTest(filename string, isa *ISA) error {
+	w := newGoOutputFile(filename)
+
+	writeFileHeader(w, goComments)
+	fmt.Fprintf(w, "package %s\n\n", goPackageName)
+	w.WriteString("import (\n")
+	w.WriteString("\t\"bytes\"\n")
+	w.WriteString("\t\"fmt\"\n")
+	w.WriteString("\t\"testing\"\n")
+	w.WriteString(")\n\n")
+
+	w.WriteString("func TestDecode(t *testing.T) {\n")
+	w.WriteString("\ttests := []struct {\n")
+	w.WriteString("\t\tWord uint32\n")
+	w.WriteString("\t\tXLEN int\n")
+	w.WriteString("\t\tWant Op\n")
+	w.WriteString("\t}{\n")
+	for _, vec := range buildTestVectors(isa) {
+		fmt.Fprintf(w, "\t\t{0x%08x, %d, Op%s},\n", uint32(vec.Word), int(vec.Size), vec.Op.TypeName)
+	}
+	w.WriteString("\t}\n\n")
+	w.WriteString("\tfor _, test := range tests {\n")
+	w.WriteString("\t\tt.Run(fmt.Sprintf(\"RV%d/%s/%#08x\", test.XLEN, test.Want, test.Word), func(t *testing.T) {\n")
+	w.WriteString("\t\t\tgot := Decode(test.Word, test.XLEN)\n")
+	w.WriteString("\t\t\tif got != test.Want {\n")
+	w.WriteString("\t\t\t\tt.Errorf(\"wrong result\\ngot:  %s\\nwant: %s\", got, test.Want)\n")
+	w.WriteString("\t\t\t}\n")
+	w.WriteString("\t\t})\n")
+	w.WriteString("\t}\n")
+	w.WriteString("}\n\n")
+
+	// The stream test concatenates the RV64 vectors, each at its own
+	// length, and ends with the first parcel of a standard-length
+	// instruction to check that truncation is reported.
+	w.WriteString("func TestDecodeStream(t *testing.T) {\n")
+	w.WriteString("\twant := []Op{\n")
+	var stream []byte
+	for _, vec := range buildTestVectors(isa) {
+		if vec.Size != RV64 {
+			continue
+		}
+		fmt.Fprintf(w, "\t\tOp%s,\n", vec.Op.TypeName)
+		for i := 0; i < instructionLength(vec.Word); i++ {
+			stream = append(stream, byte(vec.Word>>(8*uint(i))))
+		}
+	}
+	w.WriteString("\t}\n")
+	w.WriteString("\tstream := []byte{")
+	for i, b := range stream {
+		if i%16 == 0 {
+			w.WriteString("\n\t\t")
+		}
+		fmt.Fprintf(w, "0x%02x, ", b)
+	}
+	w.WriteString("\n\t\t0x13, 0x00,\n")
+	w.WriteString("\t}\n\n")
+	w.WriteString("\tvar got []Op\n")
+	w.WriteString("\tvar lastErr error\n")
+	w.WriteString("\terr := DecodeStream(bytes.NewReader(stream), 64, func(inst Instruction, err error) bool {\n")
+	w.WriteString("\t\tif err != nil {\n")
+	w.WriteString("\t\t\tlastErr = err\n")
+	w.WriteString("\t\t\treturn true\n")
+	w.WriteString("\t\t}\n")
+	w.WriteString("\t\tgot = append(got, inst.Op)\n")
+	w.WriteString("\t\treturn true\n")
+	w.WriteString("\t})\n")
+	w.WriteString("\tif err != nil {\n")
+	w.WriteString("\t\tt.Fatalf(\"unexpected error: %s\", err)\n")
+	w.WriteString("\t}\n")
+	w.WriteString("\tif lastErr != ErrTruncated {\n")
+	w.WriteString("\t\tt.Errorf(\"wrong final error\\ngot:  %v\\nwant: %v\", lastErr, ErrTruncated)\n")
+	w.WriteString("\t}\n")
+	w.WriteString("\tif len(got) != len(want) {\n")
+	w.WriteString("\t\tt.Fatalf(\"decoded %d operations, but want %d\", len(got), len(want))\n")
+	w.WriteString("\t}\n")
+	w.WriteString("\tfor i := range want {\n")
+	w.WriteString("\t\tif got[i] != want[i] {\n")
+	w.WriteString("\t\t\tt.Errorf(\"wrong operation %d\\ngot:  %s\\nwant: %s\", i, got[i], want[i])\n")
+	w.WriteString("\t\t}\n")
+	w.WriteString("\t}\n")
+	w.WriteString("}\n")
+
+	return w.Close()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoOutputFileInvalidSource(t *testing.T) {
+	// Truncating the stream template partway through a declaration stands
+	// in for an emitter bug that produces invalid Go.
+	filename := filepath.Join(t.TempDir(), "stream.go")
+	w := newGoOutputFile(filename)
+	w.WriteString("package " + goPackageName + "\n\n")
+	w.WriteString(goStreamSource[:strings.Index(goStreamSource, "func DecodeStream")+len("func DecodeStream(")])
+
+	err := w.Close()
+	if err == nil {
+		t.Fatal("Close succeeded; want an error for the invalid source")
+	}
+	if !strings.Contains(err.Error(), "generated invalid Go source") {
+		t.Errorf("wrong error: %s", err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("invalid source was written to %s", filename)
+	}
+}
+
+func TestGoOutputFileFormats(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "op.go")
+	w := newGoOutputFile(filename)
+	w.WriteString("package riscv\n\nconst (\nOpA = 1 // first\nOpLonger = 2 // second\n)\n")
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package riscv\n\nconst (\n\tOpA      = 1 // first\n\tOpLonger = 2 // second\n)\n"
+	if string(got) != want {
+		t.Errorf("wrong output\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
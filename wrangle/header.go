@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// commentStyle describes how to write comments in the syntax of one of the
+// output languages. Languages with only block comments set Begin and End,
+// in which case Line is written at the start of each line between them.
+type commentStyle struct {
+	Begin string
+	Line  string
+	End   string
+}
+
+var (
+	rustComments = commentStyle{Line: "//"}
+	goComments   = commentStyle{Line: "//"}
+	cppComments  = commentStyle{Line: "//"}
+	dotComments  = commentStyle{Begin: "/*", Line: " *", End: " */"}
+	yamlComments = commentStyle{Line: "#"}
+)
+
+// WriteComment writes the given text as a comment, one comment line per
+// line of text.
+func (s commentStyle) WriteComment(w io.Writer, text string) {
+	if s.Begin != "" {
+		fmt.Fprintln(w, s.Begin)
+	}
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if line == "" {
+			fmt.Fprintln(w, s.Line)
+		} else {
+			fmt.Fprintf(w, "%s %s\n", s.Line, line)
+		}
+	}
+	if s.End != "" {
+		fmt.Fprintln(w, s.End)
+	}
+}
+
+// fileHeader is the text written at the top of every generated file,
+// as prepared by loadFileHeader.
+var fileHeader string
+
+// loadFileHeader prepares the file header from the -header and -revision
+// options. The header mentions only the spec directories and the given
+// revision, so generating from the same spec always produces the same
+// output.
+func loadFileHeader(opts loadOptions) error {
+	source := "the riscv-meta spec"
+	if opts.UpstreamDir != "" {
+		source += " with operations from " + opts.UpstreamDir
+	}
+	if opts.OpcodesFile != "" {
+		source += " with operations from " + specFileDescription(opts.OpcodesFile)
+	}
+	for _, dir := range opts.Overlays {
+		source += " and overlay " + dir
+	}
+	for _, filename := range opts.MergeOpcodes {
+		source += " and operations from " + specFileDescription(filename)
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "Code generated by wrangle from %s. DO NOT EDIT.\n", source)
+	if *revision != "" {
+		fmt.Fprintf(&buf, "Source revision: %s\n", *revision)
+	}
+	if *headerFile != "" {
+		src, err := os.ReadFile(*headerFile)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("\n")
+		buf.Write(src)
+	}
+	fileHeader = buf.String()
+	return nil
+}
+
+// specFileDescription describes the named spec file for the file header.
+func specFileDescription(filename string) string {
+	if filename == stdinFilename {
+		return "stdin"
+	}
+	return filename
+}
+
+// writeFileHeader writes the file header as a comment in the given style,
+// followed by a blank line.
+func writeFileHeader(w io.Writer, style commentStyle) {
+	style.WriteComment(w, fileHeader)
+	fmt.Fprintln(w)
+}
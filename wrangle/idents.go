@@ -1,10 +1,119 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 	"unicode"
 )
 
+// NameStyle is a strategy for turning names from the spec files into
+// identifiers in generated code.
+type NameStyle int
+
+const (
+	NamePascal NameStyle = iota // e.g. FmaddS
+	NameSnake                   // e.g. fmadd_s
+)
+
+// ParseNameStyle returns the style with the given name, as used on the
+// command line.
+func ParseNameStyle(s string) (NameStyle, error) {
+	switch s {
+	case "pascal":
+		return NamePascal, nil
+	case "snake":
+		return NameSnake, nil
+	default:
+		return NamePascal, fmt.Errorf("unsupported name style %q", s)
+	}
+}
+
+// Ident returns an identifier for the given name in this style.
+func (s NameStyle) Ident(name string) string {
+	switch s {
+	case NameSnake:
+		return makeIdentUnderscores(name)
+	default:
+		return makeIdentTitle(name)
+	}
+}
+
+// RustIdent is like Ident but also escapes the result if it would
+// otherwise collide with a Rust keyword.
+func (s NameStyle) RustIdent(name string) string {
+	return escapeRustIdent(s.Ident(name))
+}
+
+// MnemonicStyle is a way of writing the dotted mnemonics of the spec, such
+// as fmadd.s, for tools that don't accept dots in mnemonics.
+type MnemonicStyle int
+
+const (
+	MnemonicDotted     MnemonicStyle = iota // e.g. fmadd.s
+	MnemonicUnderscore                      // e.g. fmadd_s
+	MnemonicJoined                          // e.g. fmadds
+)
+
+// mnemonicStyle is the style for mnemonics in disassembly and in the
+// string tables of generated code, as chosen with the -mnemonics option.
+var mnemonicStyle = MnemonicDotted
+
+// ParseMnemonicStyle returns the style with the given name, as used on the
+// command line.
+func ParseMnemonicStyle(s string) (MnemonicStyle, error) {
+	switch s {
+	case "dotted":
+		return MnemonicDotted, nil
+	case "underscore":
+		return MnemonicUnderscore, nil
+	case "joined":
+		return MnemonicJoined, nil
+	default:
+		return MnemonicDotted, fmt.Errorf("unsupported mnemonic style %q", s)
+	}
+}
+
+// renderMnemonic returns the given mnemonic, as written in the spec, in
+// the given style.
+func renderMnemonic(name string, style MnemonicStyle) string {
+	switch style {
+	case MnemonicUnderscore:
+		return strings.ReplaceAll(name, ".", "_")
+	case MnemonicJoined:
+		return strings.ReplaceAll(name, ".", "")
+	default:
+		return name
+	}
+}
+
+// rustKeywords are the strict and reserved keywords of Rust, which can't
+// be used as identifiers without escaping.
+var rustKeywords = map[string]struct{}{
+	"as": {}, "async": {}, "await": {}, "break": {}, "const": {},
+	"continue": {}, "crate": {}, "dyn": {}, "else": {}, "enum": {},
+	"extern": {}, "false": {}, "fn": {}, "for": {}, "if": {}, "impl": {},
+	"in": {}, "let": {}, "loop": {}, "match": {}, "mod": {}, "move": {},
+	"mut": {}, "pub": {}, "ref": {}, "return": {}, "self": {}, "Self": {},
+	"static": {}, "struct": {}, "super": {}, "trait": {}, "true": {},
+	"type": {}, "unsafe": {}, "use": {}, "where": {}, "while": {},
+	"abstract": {}, "become": {}, "box": {}, "do": {}, "final": {},
+	"macro": {}, "override": {}, "priv": {}, "typeof": {}, "unsized": {},
+	"virtual": {}, "yield": {}, "try": {},
+}
+
+func escapeRustIdent(ident string) string {
+	if _, ok := rustKeywords[ident]; !ok {
+		return ident
+	}
+	switch ident {
+	case "crate", "self", "Self", "super":
+		// These can't be used as raw identifiers.
+		return ident + "_"
+	default:
+		return "r#" + ident
+	}
+}
+
 func makeIdentUnderscores(inp string) string {
 	var b strings.Builder
 	for i, r := range inp {
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// printImmediateReport writes, for each encoding of the named operation,
+// the decode steps of each of its immediate operands along with a worked
+// example of encoding a value, showing which bits of the value land where
+// in the instruction word. If value is nil, each operand's example uses a
+// pattern of alternating bits covering its whole range.
+func printImmediateReport(w io.Writer, isa *ISA, name string, value *int64) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	w = tw
+	found := false
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if op.Name != name {
+			continue
+		}
+		found = true
+
+		// Size-specific operands, such as shift amounts, are shown as
+		// encoded for the smallest base ISA that has the operation.
+		size := op.Standards.MinSize()
+		fmt.Fprintf(w, "%s (%s, as RV%d):\n", op.Name, op.Standards, int(size))
+
+		word := op.Test
+		imms := 0
+		for _, argName := range op.Codec.Operands {
+			arg := isa.Argument(argName, size)
+			if !arg.IsImmediate() {
+				continue
+			}
+			imms++
+			v := immExampleValue(arg)
+			if value != nil {
+				v = *value
+			}
+			word |= printImmediateEncoding(w, arg, v)
+		}
+		if imms == 0 {
+			fmt.Fprintln(w, "  no immediate operands")
+			continue
+		}
+		if op.Parcels() == 1 {
+			fmt.Fprintf(w, "  instruction: 0x%04x (0b%016b)\n", uint16(word), uint16(word))
+		} else {
+			fmt.Fprintf(w, "  instruction: 0x%08x (%s)\n", uint32(word), word)
+		}
+	}
+	if !found {
+		return fmt.Errorf("no operation named %q", name)
+	}
+	return tw.Flush()
+}
+
+// printImmediateEncoding writes the decode steps of the given argument and
+// the result of inverting each of them for the given value, returning the
+// bits of the instruction word that encode the value.
+func printImmediateEncoding(w io.Writer, arg *Argument, v int64) bits32 {
+	fmt.Fprintf(w, "  %s: %s, %d bits, scale %d\n", arg.Name, arg.Type, arg.EncWidth, arg.Scale())
+	for _, step := range arg.Decoding {
+		fmt.Fprintf(w, "    decode: %s\t%s\n", step, step.Describe(arg.Name))
+	}
+
+	fmt.Fprintf(w, "    example: %s = %d (0x%x)\n", arg.Name, v, uint64(v)&(1<<uint(arg.EncWidth)-1))
+	var enc bits32
+	for _, step := range arg.Decoding {
+		enc |= step.Invert(bits32(v))
+		valHi, valLo := step.ValueRange()
+		hi, lo := step.SourceRange()
+		field := (uint32(v) >> uint(valLo)) & (1<<uint(valHi-valLo+1) - 1)
+		fmt.Fprintf(w, "      %s[%s]\t= 0b%0*b\t-> inst[%s]\n", arg.Name, bitRange(valHi, valLo), valHi-valLo+1, field, bitRange(hi, lo))
+	}
+	fmt.Fprintf(w, "    encoded: 0x%08x\n", uint32(enc))
+	if got := arg.Decode(enc); got != v {
+		fmt.Fprintf(w, "    warning: %d is not representable, and decodes as %d\n", v, got)
+	}
+	return enc
+}
+
+// immExampleValue returns a value for the given argument whose encodable
+// bits alternate between one and zero, so that each decode step of a
+// worked example has a distinctive pattern.
+func immExampleValue(arg *Argument) int64 {
+	return arg.Decode(arg.Encode(int64(0x55555555) << uint(arg.Scale())))
+}
+
+// bitRange formats a range of bit positions as in the operands file,
+// writing a single bit as just its position.
+func bitRange(hi, lo int) string {
+	if hi == lo {
+		return fmt.Sprintf("%d", hi)
+	}
+	return fmt.Sprintf("%d:%d", hi, lo)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// indentUnit is one level of indentation in generated code, as chosen with
+// the -indent and -indent-width options.
+var indentUnit = "    "
+
+// indentWriter wraps a writer to indent each line of generated code in the
+// style chosen with the -indent and -indent-width options.
+//
+// Each line is indented to the writer's current depth, as adjusted by
+// Indent, plus one level for each four leading spaces of the line as
+// written. Emitters can therefore write either in terms of depth or with
+// the conventional four-space indentation, and get the same result. Blank
+// lines are never indented.
+type indentWriter struct {
+	w     io.Writer
+	unit  string
+	depth int
+
+	// spaces counts the leading spaces written for the current line that
+	// are yet to be translated, and midLine is set once the first other
+	// character of the line has been written.
+	spaces  int
+	midLine bool
+}
+
+func newIndentWriter(w io.Writer) *indentWriter {
+	return &indentWriter{w: w, unit: indentUnit}
+}
+
+// Indent increases the depth of subsequent lines by the given number of
+// levels, or decreases it if levels is negative.
+func (iw *indentWriter) Indent(levels int) {
+	iw.depth += levels
+}
+
+func (iw *indentWriter) Write(p []byte) (int, error) {
+	var buf strings.Builder
+	for _, b := range p {
+		if !iw.midLine {
+			switch b {
+			case ' ':
+				iw.spaces++
+				continue
+			case '\n':
+				iw.spaces = 0
+				buf.WriteByte(b)
+				continue
+			}
+			buf.WriteString(strings.Repeat(iw.unit, iw.depth+iw.spaces/4))
+			buf.WriteString(strings.Repeat(" ", iw.spaces%4))
+			iw.spaces = 0
+			iw.midLine = true
+		}
+		buf.WriteByte(b)
+		if b == '\n' {
+			iw.midLine = false
+		}
+	}
+	if _, err := io.WriteString(iw.w, buf.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (iw *indentWriter) WriteString(s string) (int, error) {
+	return iw.Write([]byte(s))
+}
+
+// parseIndentUnit returns the string for one level of indentation in the
+// given style, which is either "spaces" or "tabs". The width applies only
+// to spaces.
+func parseIndentUnit(style string, width int) (string, error) {
+	switch style {
+	case "spaces":
+		if width < 1 {
+			return "", fmt.Errorf("indent width must be at least 1")
+		}
+		return strings.Repeat(" ", width), nil
+	case "tabs":
+		return "\t", nil
+	default:
+		return "", fmt.Errorf("unsupported indent style %q; must be spaces or tabs", style)
+	}
+}
@@ -1,5 +1,11 @@
 package main
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 type MajorOpcode struct {
 	Name     string
 	FuncName string
@@ -11,6 +17,7 @@ type Codec struct {
 	Name     string
 	FuncName string
 	TypeName string
+	Format   string
 	Operands []string
 }
 
@@ -18,6 +25,7 @@ type Operation struct {
 	FullName    string
 	Description string
 	Pseudocode  string
+	PseudocodeC string
 	Name        string
 	FuncName    string
 	TypeName    string
@@ -25,6 +33,88 @@ type Operation struct {
 	Codec       *Codec
 	Test, Mask  bits32
 	Standards   Standards
+	Hints       [][]OperandCondition
+	Constraints []OperandCondition
+
+	// Implicit lists the registers that the operation always uses without
+	// encoding them in any of its operands, such as the link register of
+	// c.jal.
+	Implicit []ImplicitOperand
+
+	// Attrs is the set of boolean attributes of the operation, such as
+	// "branch" or "memory", from the attributes file.
+	Attrs map[string]struct{}
+
+	// Ignore is the mask of the bits that the spec explicitly marks as not
+	// decoded, such as the unused fields of fence, and so are neither
+	// fixed nor part of an operand.
+	Ignore bits32
+}
+
+// HasAttr returns true if the operation has the named attribute.
+func (op *Operation) HasAttr(name string) bool {
+	_, ok := op.Attrs[name]
+	return ok
+}
+
+// AttrNames returns the names of all of the attributes that any of the
+// ISA's operations has, in lexical order.
+func (isa *ISA) AttrNames() []string {
+	var names []string
+	for _, op := range isa.Ops {
+		for name := range op.Attrs {
+			names = append(names, name)
+		}
+	}
+	return sortedUnique(names)
+}
+
+// ImplicitOperand is an integer register that an operation uses in a
+// particular role, named as for the operands of the equivalent uncompressed
+// instruction: "rd", "rs1", or "rs2".
+type ImplicitOperand struct {
+	Role string
+	Reg  int
+}
+
+// ImplicitReg returns the register that the operation implicitly uses in
+// the given role, if any.
+func (op *Operation) ImplicitReg(role string) (int, bool) {
+	for _, imp := range op.Implicit {
+		if imp.Role == role {
+			return imp.Reg, true
+		}
+	}
+	return 0, false
+}
+
+// DocText returns the text to use when documenting the operation in
+// generated code: its description, or failing that its full name, or
+// failing that a placeholder naming the instruction, so that the result is
+// never empty.
+func (op *Operation) DocText() string {
+	switch {
+	case op.Description != "":
+		return op.Description
+	case op.FullName != "":
+		return op.FullName
+	default:
+		return fmt.Sprintf("The %s instruction.", strings.ToUpper(op.Name))
+	}
+}
+
+// OperandCondition is a condition on an operand value. A group of
+// conditions can identify a HINT encoding of an operation, or constrain
+// which of its encodings are valid.
+type OperandCondition struct {
+	Arg      *Argument
+	Value    int64
+	NotEqual bool
+
+	// Modulus, if nonzero, means that the condition applies to the
+	// remainder of the operand value divided by Modulus, such as for
+	// operands that must name an even-numbered register.
+	Modulus int64
 }
 
 type Argument struct {
@@ -36,13 +126,185 @@ type Argument struct {
 	Type          ArgType
 	EncWidth      int
 	Decoding      []ArgDecodeStep
+
+	// Sizes optionally gives a different encoding of the argument for
+	// particular base ISA sizes, such as for a shift amount whose width
+	// depends on XLEN. Use ForSize to select the appropriate encoding.
+	Sizes map[Size]*Argument
+}
+
+type CSR struct {
+	Name        string
+	FuncName    string
+	TypeName    string
+	Description string
+	Num         bits16
+	Access      string
+	ReadOnly    bool
+	Deprecated  bool
+}
+
+type Register struct {
+	Name        string
+	ABIName     string
+	Num         int
+	Type        ArgType
+	Save        string
+	Description string
+}
+
+// fixedFields are the fields that appear in the same bit positions in all
+// of the standard-length instruction encodings, regardless of the codec.
+var fixedFields = []struct {
+	Name   string
+	Hi, Lo uint
+}{
+	{"opcode", 6, 0},
+	{"rd", 11, 7},
+	{"funct3", 14, 12},
+	{"rs1", 19, 15},
+	{"rs2", 24, 20},
+	{"funct7", 31, 25},
 }
 
 type ISA struct {
-	ExtensionNames map[Extension]string
-	MajorOpcodes   map[bits8]*MajorOpcode
-	Codecs         map[string]*Codec
-	Arguments      map[string]*Argument
-	Expansions     map[string]string
-	Ops            []Operation
+	ExtensionNames  map[Extension]string
+	ExtensionStatus map[Extension]ExtensionStatus
+	MajorOpcodes    map[bits8]*MajorOpcode
+	Codecs          map[string]*Codec
+	Arguments       map[string]*Argument
+	Expansions      map[string]string
+	Ops             []Operation
+	ExcludedOps     []Operation
+	CSRs            []*CSR
+	Registers       []*Register
+
+	// LoadWarnings are the anomalies found while loading the spec files,
+	// which the loader tolerated by skipping whatever was problematic.
+	LoadWarnings []string
+}
+
+// FilterExtensions removes from Ops any operation that doesn't belong to at
+// least one of the given extensions, retaining them in ExcludedOps instead.
+// If size isn't RVInvalid then an operation must belong to one of the
+// extensions under that base ISA size, so that an RV64-only operation is
+// removed when filtering for RV32.
+func (isa *ISA) FilterExtensions(size Size, exts []Extension) {
+	var kept []Operation
+	for _, op := range isa.Ops {
+		keep := false
+		for _, ext := range exts {
+			belongs := op.Standards.HasExtension(ext)
+			if size != RVInvalid {
+				belongs = op.Standards.Has(MakeStandard(size, ext))
+			}
+			if belongs {
+				keep = true
+				break
+			}
+		}
+		if keep {
+			kept = append(kept, op)
+		} else {
+			isa.ExcludedOps = append(isa.ExcludedOps, op)
+		}
+	}
+	isa.Ops = kept
+}
+
+// IsDraft returns true if the operation belongs to any extension whose
+// specification is still a draft.
+func (isa *ISA) IsDraft(op *Operation) bool {
+	for _, ext := range op.Standards.Extensions() {
+		if isa.ExtensionStatus[ext] == ExtDraft {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludeDrafts removes from Ops any operation that belongs to a draft
+// extension, retaining them in ExcludedOps instead.
+func (isa *ISA) ExcludeDrafts() {
+	var kept []Operation
+	for i := range isa.Ops {
+		if op := &isa.Ops[i]; isa.IsDraft(op) {
+			isa.ExcludedOps = append(isa.ExcludedOps, *op)
+		} else {
+			kept = append(kept, *op)
+		}
+	}
+	isa.Ops = kept
+}
+
+// ExcludeCompressed removes from Ops every operation of the C extension,
+// retaining them in ExcludedOps instead, so that the ISA has only
+// standard-length operations.
+func (isa *ISA) ExcludeCompressed() {
+	var kept []Operation
+	for i := range isa.Ops {
+		if op := &isa.Ops[i]; op.Standards.HasExtension(ExtC) {
+			isa.ExcludedOps = append(isa.ExcludedOps, *op)
+		} else {
+			kept = append(kept, *op)
+		}
+	}
+	isa.Ops = kept
+}
+
+// OpsForMajor returns all of the operations that belong to the major
+// opcode with the given number, ordered from most to least specific mask.
+func (isa *ISA) OpsForMajor(num bits8) []*Operation {
+	var ret []*Operation
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if op.MajorOpcode != nil && op.MajorOpcode.Num == num {
+			ret = append(ret, op)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Specificity() > ret[j].Specificity()
+	})
+	return ret
+}
+
+// OpsForMajorName is like OpsForMajor but selects the major opcode by
+// name, such as "OP-IMM". It returns nil if there is no such major opcode.
+func (isa *ISA) OpsForMajorName(name string) []*Operation {
+	for num, majorOp := range isa.MajorOpcodes {
+		if majorOp.Name == name {
+			return isa.OpsForMajor(num)
+		}
+	}
+	return nil
+}
+
+// Argument returns the argument with the given name as encoded under the
+// given base ISA size, or nil if there is no such argument.
+func (isa *ISA) Argument(name string, size Size) *Argument {
+	arg := isa.Arguments[name]
+	if arg == nil {
+		return nil
+	}
+	return arg.ForSize(size)
+}
+
+// RegisterName returns the name of the given register number of the given
+// type, using either its ABI name or its architectural name as requested.
+// If the register isn't known then the result is the architectural name
+// derived from the register number.
+func (isa *ISA) RegisterName(ty ArgType, num int, abi bool) string {
+	for _, reg := range isa.Registers {
+		if reg.Type != ty || reg.Num != num {
+			continue
+		}
+		if abi && reg.ABIName != "" {
+			return reg.ABIName
+		}
+		return reg.Name
+	}
+	if ty == ArgFloatReg {
+		return fmt.Sprintf("f%d", num)
+	}
+	return fmt.Sprintf("x%d", num)
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// kaitaiField is a bit field in a Kaitai Struct type, covering bits Hi
+// down to Lo of the instruction word.
+type kaitaiField struct {
+	ID     string
+	Hi, Lo int
+}
+
+// kaitaiInstance is a value that Kaitai Struct computes from the fields of
+// a type, used to reassemble operands that are split across several fields
+// or need sign extension.
+type kaitaiInstance struct {
+	ID    string
+	Value string
+}
+
+// generateKaitaiStruct writes a Kaitai Struct definition of a standard-length
+// instruction word, which selects a type for the fields after the opcode
+// according to the instruction format that the opcode's operations use.
+// The layout of each format comes from the codec of the same name.
+func generateKaitaiStruct(filename string, isa *ISA) error {
+	err := os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	w, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// The formats are emitted in a fixed order so that the output is
+	// deterministic.
+	var formats []string
+	codecs := make(map[string]*Codec)
+	for baseType, format := range encodingFormats {
+		if codec := kaitaiFormatCodec(isa, baseType); codec != nil {
+			formats = append(formats, format)
+			codecs[format] = codec
+		}
+	}
+	sort.Strings(formats)
+
+	writeFileHeader(w, yamlComments)
+	w.WriteString("meta:\n")
+	w.WriteString("  id: riscv_instruction\n")
+	w.WriteString("  title: RISC-V standard-length instruction\n")
+	w.WriteString("  endian: le\n")
+	w.WriteString("  bit-endian: le\n")
+	w.WriteString("doc: |\n")
+	w.WriteString("  A 32-bit RISC-V instruction word. The fields after the opcode are\n")
+	w.WriteString("  parsed according to the instruction format used by most operations\n")
+	w.WriteString("  of the opcode. Compressed instructions are not described.\n")
+	w.WriteString("seq:\n")
+	w.WriteString("  - id: opcode\n")
+	w.WriteString("    type: b7\n")
+	w.WriteString("    enum: opcode\n")
+	w.WriteString("  - id: body\n")
+	w.WriteString("    type:\n")
+	w.WriteString("      switch-on: opcode\n")
+	w.WriteString("      cases:\n")
+	for _, majorOp := range sortedMajorOpcodes(isa.MajorOpcodes) {
+		if format := isa.MajorOpcodeFormat(majorOp); codecs[format] != nil {
+			fmt.Fprintf(w, "        'opcode::%s': format_%s\n", majorOp.FuncName, strings.ToLower(format))
+		}
+	}
+	w.WriteString("        _: format_unknown\n")
+
+	w.WriteString("types:\n")
+	for _, format := range formats {
+		fields, instances := kaitaiCodecLayout(isa, codecs[format])
+		fmt.Fprintf(w, "  format_%s:\n", strings.ToLower(format))
+		fmt.Fprintf(w, "    doc: The %s instruction format.\n", format)
+		writeKaitaiSeq(w, fields)
+		if len(instances) != 0 {
+			w.WriteString("    instances:\n")
+			for _, inst := range instances {
+				fmt.Fprintf(w, "      %s:\n", inst.ID)
+				fmt.Fprintf(w, "        value: %s\n", inst.Value)
+			}
+		}
+	}
+	w.WriteString("  format_unknown:\n")
+	w.WriteString("    doc: The remaining bits of an instruction with no standard format.\n")
+	writeKaitaiSeq(w, []kaitaiField{{"bits", 31, 7}})
+
+	w.WriteString("enums:\n")
+	w.WriteString("  opcode:\n")
+	for _, majorOp := range sortedMajorOpcodes(isa.MajorOpcodes) {
+		fmt.Fprintf(w, "    0x%02x: %s\n", uint8(majorOp.Num), majorOp.FuncName)
+	}
+
+	return w.Close()
+}
+
+func writeKaitaiSeq(w codeWriter, fields []kaitaiField) {
+	w.WriteString("    seq:\n")
+	for _, field := range fields {
+		fmt.Fprintf(w, "      - id: %s\n", field.ID)
+		fmt.Fprintf(w, "        type: b%d\n", field.Hi-field.Lo+1)
+	}
+}
+
+// kaitaiFormatCodec returns the codec that describes the layout of the
+// format with the given base type, preferring the codec whose name is
+// exactly the base type. It returns nil if no codec has that base type.
+func kaitaiFormatCodec(isa *ISA, baseType string) *Codec {
+	if codec, ok := isa.Codecs[baseType]; ok {
+		return codec
+	}
+	for _, name := range sortedCodecNames(isa.Codecs) {
+		if codec := isa.Codecs[name]; codec.BaseType() == baseType {
+			return codec
+		}
+	}
+	return nil
+}
+
+// kaitaiCodecLayout returns the bit fields of bits 31:7 of the given codec,
+// ordered from the least significant bit as Kaitai Struct reads them with
+// little-endian bit order, along with instances that reassemble operands
+// whose fields alone don't give their values. Bits not belonging to any
+// operand are named after the fixed field at that position, if any.
+func kaitaiCodecLayout(isa *ISA, codec *Codec) ([]kaitaiField, []kaitaiInstance) {
+	var fields []kaitaiField
+	var instances []kaitaiInstance
+	var covered bits32
+	for _, argName := range codec.Operands {
+		arg := isa.Argument(argName, RV32)
+		multi := len(arg.Decoding) > 1
+		if !multi && !arg.IsSigned() && arg.Scale() == 0 {
+			hi, lo := arg.Decoding[0].SourceRange()
+			fields = append(fields, kaitaiField{arg.FuncName, hi, lo})
+			covered |= arg.Decoding[0].Mask
+			continue
+		}
+
+		var parts []string
+		for i, step := range arg.Decoding {
+			hi, lo := step.SourceRange()
+			id := arg.FuncName + "_bits"
+			if multi {
+				id += fmt.Sprintf("%d", i)
+			}
+			fields = append(fields, kaitaiField{id, hi, lo})
+			covered |= step.Mask
+
+			// Single-bit fields are booleans in Kaitai Struct.
+			if hi == lo {
+				id += ".to_i"
+			}
+			if pos := lo - step.RightShift; pos != 0 {
+				parts = append(parts, fmt.Sprintf("(%s << %d)", id, pos))
+			} else {
+				parts = append(parts, id)
+			}
+		}
+		value := strings.Join(parts, " | ")
+		if arg.IsSigned() {
+			sign := fmt.Sprintf("(1 << %d)", arg.EncWidth-1)
+			value = fmt.Sprintf("((%s) ^ %s) - %s", value, sign, sign)
+		}
+		instances = append(instances, kaitaiInstance{arg.FuncName, value})
+	}
+
+	// The remaining bits are split at the boundaries of the fixed fields,
+	// so that a gap such as bits 31:25 of an R-type codec becomes funct7.
+	start := -1
+	for bit := 7; bit <= 32; bit++ {
+		boundary := bit == 32 || covered&(1<<uint(bit)) != 0
+		for _, fixed := range fixedFields {
+			if bit == int(fixed.Lo) || bit == int(fixed.Hi)+1 {
+				boundary = true
+			}
+		}
+		if boundary && start != -1 {
+			fields = append(fields, kaitaiGapField(start, bit-1))
+			start = -1
+		}
+		if bit < 32 && covered&(1<<uint(bit)) == 0 && start == -1 {
+			start = bit
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Lo < fields[j].Lo
+	})
+	return fields, instances
+}
+
+func kaitaiGapField(lo, hi int) kaitaiField {
+	for _, fixed := range fixedFields {
+		if int(fixed.Hi) == hi && int(fixed.Lo) == lo {
+			return kaitaiField{fixed.Name, hi, lo}
+		}
+	}
+	return kaitaiField{fmt.Sprintf("bits_%d_%d", hi, lo), hi, lo}
+}
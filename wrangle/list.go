@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// printOperationList writes the name of each operation on a separate line.
+// In long mode it also includes the full name and standards, with one
+// line per distinct encoding of each operation.
+func printOperationList(w io.Writer, isa *ISA, long bool) error {
+	if !long {
+		var prev string
+		for _, op := range isa.Ops {
+			// isa.Ops is sorted by name, so duplicates are adjacent.
+			if op.Name == prev {
+				continue
+			}
+			prev = op.Name
+			fmt.Fprintln(w, renderMnemonic(op.Name, mnemonicStyle))
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, op := range isa.Ops {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", renderMnemonic(op.Name, mnemonicStyle), op.FullName, op.Standards)
+	}
+	return tw.Flush()
+}
+
+// printOperationTable writes one row for each operation, with the details
+// of its encoding in aligned columns.
+func printOperationTable(w io.Writer, isa *ISA) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "NAME\tTEST\tMASK\tCODEC\tCATEGORY\tSTANDARDS\n")
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		fmt.Fprintf(tw, "%s\t0x%08x\t0x%08x\t%s\t%s\t%s\n", renderMnemonic(op.Name, mnemonicStyle), uint32(op.Test), uint32(op.Mask), op.Codec.Name, op.Category(isa), op.Standards)
+	}
+	return tw.Flush()
+}
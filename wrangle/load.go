@@ -3,63 +3,368 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io/fs"
+	"log"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"unicode"
 )
 
-func loadISAMeta() (*ISA, error) {
-	extNames, err := loadExtensionNames("extensions")
+// loadOptions customizes where loadISAMeta finds the spec files.
+type loadOptions struct {
+	// SpecFS holds the base spec files. If it's nil then they are loaded
+	// from the working directory.
+	SpecFS fs.FS
+
+	// Overlays are directories of additional spec files to merge into
+	// the base ISA, in order.
+	Overlays []string
+
+	// UpstreamDir, if set, is a checkout of the upstream riscv-opcodes
+	// repository whose instruction files should be loaded in place of
+	// our own opcodes file.
+	UpstreamDir string
+
+	// OpcodesFile, if set, is loaded in place of our own opcodes file.
+	// It may be "-" to read the operations from stdin.
+	OpcodesFile string
+
+	// MergeOpcodes are additional operations files to merge over the
+	// operations in the same way as an overlay's opcodes file. Each may
+	// be "-" to read from stdin.
+	MergeOpcodes []string
+}
+
+// stdinFilename is the filename that refers to stdin, for the options
+// that accept spec files.
+const stdinFilename = "-"
+
+// validate checks for options that cannot be used together.
+func (opts loadOptions) validate() error {
+	if opts.OpcodesFile != "" && opts.UpstreamDir != "" {
+		return fmt.Errorf("cannot load operations from both %s and upstream %s", opts.OpcodesFile, opts.UpstreamDir)
+	}
+	stdinUses := 0
+	for _, filename := range append([]string{opts.OpcodesFile}, opts.MergeOpcodes...) {
+		if filename == stdinFilename {
+			stdinUses++
+		}
+	}
+	if stdinUses > 1 {
+		return fmt.Errorf("stdin (%q) can be given for only one spec file, but was given for %d", stdinFilename, stdinUses)
+	}
+	return nil
+}
+
+// specFS returns the file system holding the base spec files.
+func (opts loadOptions) specFS() fs.FS {
+	if opts.SpecFS == nil {
+		return hostFS{}
+	}
+	return opts.SpecFS
+}
+
+// hostFS is the file system of the host, for the spec files and
+// directories given on the command line. Unlike os.DirFS, it accepts
+// absolute paths and paths that leave the working directory.
+type hostFS struct{}
+
+func (hostFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// openSpecFile opens the named spec file in fsys for reading, or returns
+// stdin if the name is stdinFilename. It records the names of the files it
+// opens in specFilesRead.
+func openSpecFile(fsys fs.FS, filename string) (fs.File, error) {
+	if filename == stdinFilename {
+		specFilesRead = append(specFilesRead, filename)
+		return os.Stdin, nil
+	}
+	f, err := fsys.Open(filename)
+	if err == nil {
+		specFilesRead = append(specFilesRead, filename)
+	}
+	return f, err
+}
+
+// specFilesRead are the names of the spec files that have been opened for
+// loading, in the order they were opened, for the manifest of generated
+// files.
+var specFilesRead []string
+
+func loadISAMeta(opts loadOptions) (*ISA, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	overlays := opts.Overlays
+	specFS := opts.specFS()
+	timer := startPhase("load extensions")
+	defer timer.Stop()
+
+	extNames, err := loadExtensionNames(specFS, "extensions")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load extension names: %s", err)
 	}
-	majorOpcodes, err := loadMajorOpcodes("opcode-majors")
+	timer.Next("load extension-status")
+	extStatus, err := loadExtensionStatus(specFS, "extension-status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load extension status: %s", err)
+	}
+	timer.Next("load opcode-majors")
+	majorOpcodes, err := loadMajorOpcodes(specFS, "opcode-majors")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load major opcodes: %s", err)
 	}
-	codecs, err := loadCodecs("codecs")
+	timer.Next("load codecs")
+	codecs, err := loadCodecs(specFS, "codecs")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load codecs: %s", err)
 	}
-	args, err := loadArgs("operands")
+	timer.Next("load operands")
+	args, err := loadArgs(specFS, "operands")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load operands: %s", err)
 	}
-	opFullNames, err := loadOpcodeStrings("opcode-fullnames")
+	timer.Next("load opcode-fullnames")
+	opFullNames, err := loadOpcodeStrings(specFS, "opcode-fullnames")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load operation full names: %s", err)
 	}
-	opDescs, err := loadOpcodeStrings("opcode-descriptions")
+	timer.Next("load opcode-descriptions")
+	opDescs, err := loadOpcodeStrings(specFS, "opcode-descriptions")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load operation descriptions: %s", err)
 	}
-	opPseudocode, err := loadOpcodeStrings("opcode-pseudocode-alt")
+	timer.Next("load opcode-pseudocode-alt")
+	opPseudocode, err := loadOpcodeStrings(specFS, "opcode-pseudocode-alt")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load operation pseudocode: %s", err)
 	}
-	ops, err := loadOperations("opcodes", majorOpcodes, codecs, opFullNames, opDescs, opPseudocode)
+	timer.Next("load opcode-pseudocode-c")
+	opPseudocodeC, err := loadOpcodeStrings(specFS, "opcode-pseudocode-c")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load operation C pseudocode: %s", err)
+	}
+
+	// Overlays must be merged before we load the operations, because
+	// overlay operations may refer to overlay codecs, and overlay
+	// documentation may describe base operations.
+	timer.Next("load overlays")
+	for _, dir := range overlays {
+		err := mergeOverlayMeta(dir, codecs, args, opFullNames, opDescs, opPseudocode, opPseudocodeC)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load overlay %s: %s", dir, err)
+		}
+	}
+
+	timer.Next("load opcodes")
+	var ops []Operation
+	if opts.UpstreamDir != "" {
+		ops, err = loadUpstreamOperations(opts.UpstreamDir, majorOpcodes, codecs, opFullNames, opDescs, opPseudocode, opPseudocodeC)
+	} else {
+		fsys, opcodesFile := specFS, "opcodes"
+		if opts.OpcodesFile != "" {
+			fsys, opcodesFile = hostFS{}, opts.OpcodesFile
+		}
+		ops, err = loadOperations(fsys, opcodesFile, majorOpcodes, codecs, opFullNames, opDescs, opPseudocode, opPseudocodeC)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to load minor opcodes: %s", err)
 	}
-	exps, err := loadExpansions("compression")
+	for _, dir := range overlays {
+		filename := filepath.Join(dir, "opcodes")
+		if !fileExists(hostFS{}, filename) {
+			continue
+		}
+		overlayOps, err := loadOperations(hostFS{}, filename, majorOpcodes, codecs, opFullNames, opDescs, opPseudocode, opPseudocodeC)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load minor opcodes from overlay %s: %s", dir, err)
+		}
+		ops = mergeOperations(ops, overlayOps, filename)
+	}
+	for _, filename := range opts.MergeOpcodes {
+		moreOps, err := loadOperations(hostFS{}, filename, majorOpcodes, codecs, opFullNames, opDescs, opPseudocode, opPseudocodeC)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load minor opcodes from %s: %s", filename, err)
+		}
+		ops = mergeOperations(ops, moreOps, filename)
+	}
+
+	timer.Next("load hints")
+	err = loadHints(specFS, "hints", ops, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hints: %s", err)
+	}
+	timer.Next("load operand-constraints")
+	err = loadConstraints(specFS, "operand-constraints", ops, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load operand constraints: %s", err)
+	}
+
+	timer.Next("load compression")
+	exps, err := loadExpansions(specFS, "compression")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load compressed opcode expansion table: %s", err)
 	}
+	timer.Next("load csrs")
+	csrs, err := loadCSRs(specFS, "csrs")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load control and status registers: %s", err)
+	}
+	timer.Next("load registers")
+	regs, err := loadRegisters(specFS, "registers")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load registers: %s", err)
+	}
+
+	timer.Next("load implicit-operands")
+	err = loadImplicitOperands(specFS, "implicit-operands", ops, regs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load implicit operands: %s", err)
+	}
+
+	timer.Next("load attributes")
+	err = loadAttributes(specFS, "attributes", ops)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load attributes: %s", err)
+	}
+
+	timer.Next("check spec")
+	for _, name := range sortedCodecNames(codecs) {
+		codec := codecs[name]
+		for _, argName := range codec.Operands {
+			if _, ok := args[argName]; !ok {
+				warnSpec("codec %q refers to unknown operand %q", codec.Name, argName)
+			}
+		}
+	}
+
+	isa := &ISA{
+		ExtensionNames:  extNames,
+		ExtensionStatus: extStatus,
+		MajorOpcodes:    majorOpcodes,
+		Codecs:          codecs,
+		Arguments:       args,
+		Ops:             ops,
+		Expansions:      exps,
+		CSRs:            csrs,
+		Registers:       regs,
+		LoadWarnings:    append([]string(nil), specWarnings...),
+	}
+	findSpecAnomalies(isa)
+	return isa, nil
+}
+
+// specWarnings collects descriptions of the anomalies found while loading
+// the spec files. By default we tolerate these by skipping whatever was
+// problematic, but in strict mode they are fatal.
+var specWarnings []string
+
+func warnSpec(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	specWarnings = append(specWarnings, msg)
+	if *verbose || *strict {
+		log.Print(msg)
+	}
+}
+
+// mergeOverlayMeta loads any codecs, operands, and operation documentation
+// files present in the given overlay directory, adding them to the given
+// maps. Definitions in the overlay replace those of the same name that were
+// already present.
+func mergeOverlayMeta(dir string, codecs map[string]*Codec, args map[string]*Argument, fullNames, descs, pseudocode, pseudocodeC map[string]string) error {
+	if filename := filepath.Join(dir, "codecs"); fileExists(hostFS{}, filename) {
+		more, err := loadCodecs(hostFS{}, filename)
+		if err != nil {
+			return fmt.Errorf("failed to load codecs: %s", err)
+		}
+		for name, codec := range more {
+			codecs[name] = codec
+		}
+	}
+	if filename := filepath.Join(dir, "operands"); fileExists(hostFS{}, filename) {
+		more, err := loadArgs(hostFS{}, filename)
+		if err != nil {
+			return fmt.Errorf("failed to load operands: %s", err)
+		}
+		for name, arg := range more {
+			args[name] = arg
+		}
+	}
+
+	strs := []struct {
+		filename string
+		m        map[string]string
+	}{
+		{"opcode-fullnames", fullNames},
+		{"opcode-descriptions", descs},
+		{"opcode-pseudocode-alt", pseudocode},
+		{"opcode-pseudocode-c", pseudocodeC},
+	}
+	for _, s := range strs {
+		filename := filepath.Join(dir, s.filename)
+		if !fileExists(hostFS{}, filename) {
+			continue
+		}
+		more, err := loadOpcodeStrings(hostFS{}, filename)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %s", s.filename, err)
+		}
+		for name, str := range more {
+			s.m[name] = str
+		}
+	}
+
+	return nil
+}
+
+// mergeOperations adds the overlay operations to the base operations,
+// replacing any base operation that has the same name as an overlay
+// operation and shares at least one base ISA size with it.
+func mergeOperations(base, overlay []Operation, filename string) []Operation {
+	ret := make([]Operation, 0, len(base)+len(overlay))
+	for _, op := range base {
+		replaced := false
+		for _, newOp := range overlay {
+			if newOp.Name == op.Name && shareSize(newOp.Standards, op.Standards) {
+				replaced = true
+				break
+			}
+		}
+		if replaced {
+			log.Printf("%s: overlay redefines operation %q (%s)", filename, op.Name, op.Standards)
+			continue
+		}
+		ret = append(ret, op)
+	}
+	ret = append(ret, overlay...)
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func shareSize(a, b Standards) bool {
+	for _, size := range []Size{RV32, RV64, RV128} {
+		if a.Has(size.Any()) && b.Has(size.Any()) {
+			return true
+		}
+	}
+	return false
+}
 
-	return &ISA{
-		ExtensionNames: extNames,
-		MajorOpcodes:   majorOpcodes,
-		Codecs:         codecs,
-		Arguments:      args,
-		Ops:            ops,
-		Expansions:     exps,
-	}, nil
+func fileExists(fsys fs.FS, filename string) bool {
+	_, err := fs.Stat(fsys, filename)
+	return err == nil
 }
 
-func loadExtensionNames(filename string) (map[Extension]string, error) {
-	r, err := os.Open(filename)
+func loadExtensionNames(fsys fs.FS, filename string) (map[Extension]string, error) {
+	r, err := openSpecFile(fsys, filename)
 	if err != nil {
 		return nil, err
 	}
@@ -112,13 +417,41 @@ func loadExtensionNames(filename string) (map[Extension]string, error) {
 	return ret, sc.Err()
 }
 
-func loadMajorOpcodes(filename string) (map[bits8]*MajorOpcode, error) {
-	r, err := os.Open(filename)
+func loadExtensionStatus(fsys fs.FS, filename string) (map[Extension]ExtensionStatus, error) {
+	r, err := openSpecFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[Extension]ExtensionStatus)
+
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		fields := strings.Fields(trimComments(sc.Text()))
+		if len(fields) < 2 {
+			continue
+		}
+		status := ExtensionStatus(fields[1])
+		if status != ExtRatified && status != ExtDraft {
+			warnSpec("%s:%d: invalid status %q for extension %s", filename, line, fields[1], fields[0])
+			continue
+		}
+		ret[Extension(strings.ToUpper(fields[0])[0])] = status
+	}
+
+	return ret, sc.Err()
+}
+
+func loadMajorOpcodes(fsys fs.FS, filename string) (map[bits8]*MajorOpcode, error) {
+	r, err := openSpecFile(fsys, filename)
 	if err != nil {
 		return nil, err
 	}
 
 	ret := make(map[bits8]*MajorOpcode)
+	skippedMajorOpcodes = make(map[bits8]skippedMajorOpcode)
 
 	sc := bufio.NewScanner(r)
 	for sc.Scan() {
@@ -127,15 +460,20 @@ func loadMajorOpcodes(filename string) (map[bits8]*MajorOpcode, error) {
 		if len(fields) < 2 {
 			continue
 		}
-		name := fields[len(fields)-1]
+		rawName := fields[len(fields)-1]
 		fields = fields[:len(fields)-1]
 
+		// The name may be followed by comma-separated attributes, such as
+		// a base ISA restriction or the "custom" marker described below.
+		attrs := strings.Split(rawName, ",")
+		name := attrs[0]
+		attrs = attrs[1:]
+
 		// Only the "real" (currently assigned) opcodes are all uppercase,
 		// so we'll use that as a heuristic to filter out all the others
-		// that mark coding space reservations.
-		if strings.ToUpper(name) != name {
-			continue
-		}
+		// that mark coding space reservations. Non-standard extensions can
+		// opt out of this heuristic by adding the "custom" attribute.
+		skip := strings.ToUpper(name) != name && !hasAttr(attrs, "custom")
 
 		oc := &MajorOpcode{
 			Name:     name,
@@ -145,18 +483,73 @@ func loadMajorOpcodes(filename string) (map[bits8]*MajorOpcode, error) {
 		}
 
 		for _, rawSpec := range fields {
-			v, _ := parseMatchSpec(rawSpec)
+			v, _, _, err := parseMatchSpec(rawSpec)
+			if err != nil {
+				warnSpec("%s: major opcode %q: %s", filename, name, err)
+			}
 			oc.Num |= bits8(v)
 		}
 
+		if skip {
+			if *verbose {
+				log.Printf("%s: skipping major opcode %q because it is not uppercase", filename, name)
+			}
+			skipped := skippedMajorOpcode{Name: name}
+			for _, attr := range attrs {
+				switch attr {
+				case "rv32":
+					skipped.Base = RV32
+				case "rv64":
+					skipped.Base = RV64
+				case "rv128":
+					skipped.Base = RV128
+				}
+			}
+			skippedMajorOpcodes[oc.Num] = skipped
+			continue
+		}
 		ret[oc.Num] = oc
 	}
 
 	return ret, nil
 }
 
-func loadCodecs(filename string) (map[string]*Codec, error) {
-	r, err := os.Open(filename)
+// skippedMajorOpcode describes a major opcode that loadMajorOpcodes
+// skipped because it isn't uppercase. Base is the base ISA size the opcode
+// is restricted to, if any, such as RV128 for the opcodes that are custom
+// under RV32 and RV64 but are the standard RV128 opcode space.
+type skippedMajorOpcode struct {
+	Name string
+	Base Size
+}
+
+// skippedMajorOpcodes records the major opcodes that the most recent call
+// to loadMajorOpcodes skipped, so that an operation using one of them can be
+// reported as such rather than as using an unknown major opcode.
+var skippedMajorOpcodes map[bits8]skippedMajorOpcode
+
+// warnMissingMajorOpcode warns that the given standard-length operation
+// uses a major opcode that wasn't loaded, and so will be decoded only by
+// the generated decoders' catch-all for unknown opcodes. An operation that
+// belongs only to the base ISA size its skipped major opcode is restricted
+// to is expected, and so is only logged in verbose mode.
+func warnMissingMajorOpcode(filename string, op *Operation, num bits8) {
+	skipped, ok := skippedMajorOpcodes[num]
+	if !ok {
+		warnSpec("%s: operation %q uses unknown major opcode 0b%07b", filename, op.Name, uint8(num))
+		return
+	}
+	if skipped.Base != 0 && op.Standards.MinSize() == skipped.Base {
+		if *verbose {
+			log.Printf("%s: operation %q uses major opcode %s (0b%07b), which is reserved for RV%d", filename, op.Name, skipped.Name, uint8(num), int(skipped.Base))
+		}
+		return
+	}
+	warnSpec("%s: operation %q uses major opcode %s (0b%07b), which was not loaded because its name is lowercase", filename, op.Name, skipped.Name, uint8(num))
+}
+
+func loadCodecs(fsys fs.FS, filename string) (map[string]*Codec, error) {
+	r, err := openSpecFile(fsys, filename)
 	if err != nil {
 		return nil, err
 	}
@@ -176,6 +569,7 @@ func loadCodecs(filename string) (map[string]*Codec, error) {
 			Name:     name,
 			FuncName: makeIdentUnderscores(name),
 			TypeName: makeIdentTitle(name),
+			Format:   fields[1],
 			Operands: fields[2:],
 		}
 
@@ -185,13 +579,15 @@ func loadCodecs(filename string) (map[string]*Codec, error) {
 	return ret, sc.Err()
 }
 
-func loadArgs(filename string) (map[string]*Argument, error) {
-	r, err := os.Open(filename)
+func loadArgs(fsys fs.FS, filename string) (map[string]*Argument, error) {
+	r, err := openSpecFile(fsys, filename)
 	if err != nil {
 		return nil, err
 	}
 
 	ret := make(map[string]*Argument)
+	var sized []*Argument
+	var sizes []Size
 
 	sc := bufio.NewScanner(r)
 	for sc.Scan() {
@@ -200,14 +596,27 @@ func loadArgs(filename string) (map[string]*Argument, error) {
 		if len(fields) < 4 {
 			continue
 		}
-		name := fields[0]
+
+		// A name like "shamt@rv64" gives the encoding of the argument
+		// "shamt" for only that base ISA size. The size is also part of
+		// the identifiers, so that generated code can have a separate
+		// accessor for each encoding.
+		name, rawSize := partition(fields[0], "@")
+		var size Size
+		if rawSize != "" {
+			size = ParseStandard(rawSize + "i").Size()
+			if size == RVInvalid {
+				warnSpec("%s: operand %q has invalid base ISA size %q", filename, name, rawSize)
+				continue
+			}
+		}
 
 		decoding, encWidth := ParseArgDecodeSteps(fields[1])
 
 		arg := &Argument{
 			Name:          name,
-			FuncName:      makeIdentUnderscores(name),
-			TypeName:      makeIdentTitle(name),
+			FuncName:      makeIdentUnderscores(fields[0]),
+			TypeName:      makeIdentTitle(fields[0]),
 			FuncLocalName: strings.ReplaceAll(makeIdentUnderscores(fields[3]), "_", ""),
 			TypeLocalName: makeIdentTitle(fields[3]),
 			Type:          ArgType(fields[2]),
@@ -215,14 +624,36 @@ func loadArgs(filename string) (map[string]*Argument, error) {
 			Decoding:      decoding,
 		}
 
+		if size != RVInvalid {
+			sized = append(sized, arg)
+			sizes = append(sizes, size)
+			continue
+		}
 		ret[name] = arg
 	}
 
-	return ret, nil
+	// Size-specific encodings can appear before or after the general one,
+	// so we attach them only once we've seen the whole file.
+	for i, arg := range sized {
+		base, ok := ret[arg.Name]
+		if !ok {
+			warnSpec("%s: operand %q has an encoding for %s but no general encoding", filename, arg.Name, sizes[i].Any())
+			continue
+		}
+		if base.Sizes == nil {
+			base.Sizes = make(map[Size]*Argument)
+		}
+		base.Sizes[sizes[i]] = arg
+	}
+
+	return ret, sc.Err()
 }
 
-func loadOperations(filename string, majors map[bits8]*MajorOpcode, codecs map[string]*Codec, fullNames map[string]string, descs map[string]string, pseudocode map[string]string) ([]Operation, error) {
-	r, err := os.Open(filename)
+// loadOperations reads operations from the dialect of the opcodes file in
+// this repository. See loadOperationsV2 for the upstream riscv-opcodes
+// dialect.
+func loadOperations(fsys fs.FS, filename string, majors map[bits8]*MajorOpcode, codecs map[string]*Codec, fullNames map[string]string, descs map[string]string, pseudocode map[string]string, pseudocodeC map[string]string) ([]Operation, error) {
+	r, err := openSpecFile(fsys, filename)
 	if err != nil {
 		return nil, err
 	}
@@ -243,6 +674,7 @@ func loadOperations(filename string, majors map[bits8]*MajorOpcode, codecs map[s
 			FullName:    fullNames[name],
 			Description: descs[name],
 			Pseudocode:  pseudocode[name],
+			PseudocodeC: pseudocodeC[name],
 			Name:        name,
 			FuncName:    makeIdentUnderscores(name),
 			TypeName:    makeIdentTitle(name),
@@ -270,14 +702,19 @@ func loadOperations(filename string, majors map[bits8]*MajorOpcode, codecs map[s
 				continue
 			}
 
-			v, mask := parseMatchSpec(rawMatch)
+			v, mask, ignore, err := parseMatchSpec(rawMatch)
+			if err != nil {
+				warnSpec("%s: operation %q: %s", filename, name, err)
+			}
 			op.Test |= bits32(v)
 			op.Mask |= bits32(mask)
+			op.Ignore |= bits32(ignore)
 		}
 
 		// If we get here without having a codec set then the line must be
 		// invalid, so we'll just skip it.
 		if op.Codec == nil {
+			warnSpec("%s: operation %q has no known codec", filename, name)
 			continue
 		}
 
@@ -286,8 +723,7 @@ func loadOperations(filename string, majors map[bits8]*MajorOpcode, codecs map[s
 		// to, which an instruction decoder can use to partition the coding
 		// space rather than scanning over all of the operations every time.
 		if (op.Mask & 0b1111111) == 0b1111111 {
-			majorOpcode := bits8(op.Test & 0b1111111)
-			op.MajorOpcode = majors[majorOpcode]
+			op.MajorOpcode = majors[bits8(op.Test&0b1111111)]
 		}
 
 		// Any remaining fields should be standards identifiers indicating
@@ -300,47 +736,459 @@ func loadOperations(filename string, majors map[bits8]*MajorOpcode, codecs map[s
 			op.Standards.Add(std.Base())
 		}
 
+		// We can only tell whether a missing major opcode is expected
+		// once we know which base ISA sizes the operation belongs to.
+		if op.MajorOpcode == nil && op.Mask&0b1111111 == 0b1111111 && op.WidthBytes() == 4 {
+			warnMissingMajorOpcode(filename, &op, bits8(op.Test&0b1111111))
+		}
+
 		ret = append(ret, op)
 	}
 
-	sort.Slice(ret, func(i, j int) bool {
+	sort.SliceStable(ret, func(i, j int) bool {
 		return ret[i].Name < ret[j].Name
 	})
 
 	return ret, sc.Err()
 }
 
-func loadExpansions(filename string) (map[string]string, error) {
-	r, err := os.Open(filename)
+// loadHints reads the HINT encoding conditions from the given file and
+// attaches them to the operations they belong to. A condition group is
+// attached only to the operations whose codecs include all of the operands
+// it refers to, which allows a single file to describe operations whose
+// encodings differ between base ISA sizes.
+func loadHints(fsys fs.FS, filename string, ops []Operation, args map[string]*Argument) error {
+	r, err := openSpecFile(fsys, filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := trimComments(sc.Text())
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[0]
+
+		conds := parseOperandConditions(filename, "hint", name, fields[1:], args)
+		if conds == nil {
+			continue
+		}
+
+		for i := range ops {
+			op := &ops[i]
+			if op.Name != name || !codecHasArgs(op.Codec, conds) {
+				continue
+			}
+			op.Hints = append(op.Hints, conds)
+		}
+	}
+
+	return sc.Err()
+}
+
+// loadConstraints reads the operand constraints from the given file and
+// attaches them to the operations they belong to, using the same rules as
+// loadHints for choosing between operations of the same name.
+func loadConstraints(fsys fs.FS, filename string, ops []Operation, args map[string]*Argument) error {
+	r, err := openSpecFile(fsys, filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := trimComments(sc.Text())
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[0]
+
+		conds := parseOperandConditions(filename, "constraint", name, fields[1:], args)
+		if conds == nil {
+			continue
+		}
+
+		for i := range ops {
+			op := &ops[i]
+			if op.Name != name || !codecHasArgs(op.Codec, conds) {
+				continue
+			}
+			op.Constraints = append(op.Constraints, conds...)
+		}
+	}
+
+	return sc.Err()
+}
+
+// parseOperandConditions parses conditions written as <arg>=<value>,
+// <arg>!=<value>, or <arg>%<modulus>=<value>. If any of them is invalid
+// then it warns and returns nil, so that the whole line is skipped. kind
+// describes the file's entries for use in those warnings.
+func parseOperandConditions(filename, kind, name string, raws []string, args map[string]*Argument) []OperandCondition {
+	var conds []OperandCondition
+	for _, raw := range raws {
+		var cond OperandCondition
+		rawArg, rawValue := partition(raw, "=")
+		if strings.HasSuffix(rawArg, "!") {
+			cond.NotEqual = true
+			rawArg = rawArg[:len(rawArg)-1]
+		}
+		rawArg, rawMod := partition(rawArg, "%")
+		if rawMod != "" {
+			mod, err := strconv.ParseInt(rawMod, 0, 64)
+			if err != nil || mod <= 0 {
+				warnSpec("%s: %s for %q has invalid modulus %q", filename, kind, name, rawMod)
+				return nil
+			}
+			cond.Modulus = mod
+		}
+		cond.Arg = args[rawArg]
+		if cond.Arg == nil {
+			warnSpec("%s: %s for %q refers to unknown operand %q", filename, kind, name, rawArg)
+			return nil
+		}
+		v, err := strconv.ParseInt(rawValue, 0, 64)
+		if err != nil {
+			warnSpec("%s: %s for %q has invalid value %q", filename, kind, name, rawValue)
+			return nil
+		}
+		cond.Value = v
+		conds = append(conds, cond)
+	}
+	return conds
+}
+
+// loadImplicitOperands reads the implicit operands of operations from the
+// given file and attaches them to all of the operations of each name.
+// Registers are given either by architectural name or, if the registers
+// file was loaded, by ABI name.
+func loadImplicitOperands(fsys fs.FS, filename string, ops []Operation, regs []*Register) error {
+	r, err := openSpecFile(fsys, filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := trimComments(sc.Text())
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[0]
+
+		var imps []ImplicitOperand
+		for _, raw := range fields[1:] {
+			role, rawReg := partition(raw, "=")
+			if role != "rd" && role != "rs1" && role != "rs2" {
+				warnSpec("%s: implicit operand for %q has unknown role %q", filename, name, role)
+				imps = nil
+				break
+			}
+			reg, ok := parseIntRegister(rawReg, regs)
+			if !ok {
+				warnSpec("%s: implicit operand for %q has invalid register %q", filename, name, rawReg)
+				imps = nil
+				break
+			}
+			imps = append(imps, ImplicitOperand{Role: role, Reg: reg})
+		}
+		if imps == nil {
+			continue
+		}
+
+		found := false
+		for i := range ops {
+			if op := &ops[i]; op.Name == name {
+				op.Implicit = imps
+				found = true
+			}
+		}
+		if !found {
+			warnSpec("%s: implicit operands for unknown operation %q", filename, name)
+		}
+	}
+
+	return sc.Err()
+}
+
+// loadAttributes reads the attributes of operations from the given file
+// and adds them to the attribute sets of all of the operations of each
+// name.
+func loadAttributes(fsys fs.FS, filename string, ops []Operation) error {
+	r, err := openSpecFile(fsys, filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := trimComments(sc.Text())
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[0]
+
+		var attrs []string
+		for _, attr := range fields[1:] {
+			if !isAttrName(attr) {
+				warnSpec("%s: attribute %q of %q is not a lowercase identifier", filename, attr, name)
+				continue
+			}
+			attrs = append(attrs, attr)
+		}
+
+		found := false
+		for i := range ops {
+			op := &ops[i]
+			if op.Name != name {
+				continue
+			}
+			found = true
+			if op.Attrs == nil {
+				op.Attrs = make(map[string]struct{})
+			}
+			for _, attr := range attrs {
+				op.Attrs[attr] = struct{}{}
+			}
+		}
+		if !found {
+			warnSpec("%s: attributes for unknown operation %q", filename, name)
+		}
+	}
+
+	return sc.Err()
+}
+
+// isAttrName returns true if the given attribute name is usable in the
+// names of generated predicates: a lowercase letter followed by any number
+// of lowercase letters, digits, and underscores.
+func isAttrName(name string) bool {
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '_'):
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// parseIntRegister returns the number of the integer register with the
+// given architectural or ABI name.
+func parseIntRegister(name string, regs []*Register) (int, bool) {
+	for _, reg := range regs {
+		if reg.Type == ArgIntReg && (reg.Name == name || reg.ABIName == name) {
+			return reg.Num, true
+		}
+	}
+	if !strings.HasPrefix(name, "x") {
+		return 0, false
+	}
+	num, err := strconv.Atoi(name[1:])
+	if err != nil || num < 0 || num > 31 {
+		return 0, false
+	}
+	return num, true
+}
+
+func codecHasArgs(codec *Codec, conds []OperandCondition) bool {
+	for _, cond := range conds {
+		found := false
+		for _, argName := range codec.Operands {
+			if argName == cond.Arg.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func loadExpansions(fsys fs.FS, filename string) (map[string]string, error) {
+	r, err := openSpecFile(fsys, filename)
 	if err != nil {
 		return nil, err
 	}
 
 	ret := make(map[string]string)
+	lines := make(map[string]int)
 
 	sc := bufio.NewScanner(r)
+	lineNum := 0
 	for sc.Scan() {
+		lineNum++
 		line := trimComments(sc.Text())
 		fields := strings.Fields(line)
 		if len(fields) < 2 {
 			continue
 		}
+		if first, ok := lines[fields[0]]; ok {
+			warnSpec("%s:%d: duplicate expansion for %q, already defined on line %d", filename, lineNum, fields[0], first)
+			continue
+		}
+		lines[fields[0]] = lineNum
 		ret[fields[0]] = fields[1]
 	}
 
-	return ret, nil
+	return ret, sc.Err()
+}
+
+func loadCSRs(fsys fs.FS, filename string) ([]*CSR, error) {
+	r, err := openSpecFile(fsys, filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// The CSR list is optional, since not all users of this tool
+			// care about the privileged architecture.
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ret []*CSR
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := trimComments(sc.Text())
+		quot := strings.IndexRune(line, '"')
+		if quot < 0 {
+			continue
+		}
+		fields := strings.Fields(line[:quot])
+		desc := line[quot+1:]
+		var version string
+		quot = strings.IndexRune(desc, '"')
+		if quot >= 0 {
+			version = strings.TrimSpace(desc[quot+1:])
+			desc = desc[:quot]
+		}
+
+		// The access column is optional, so that simpler CSR lists for
+		// custom extensions can omit it.
+		var access, name string
+		switch len(fields) {
+		case 2:
+			name = fields[1]
+		case 3:
+			access = fields[1]
+			name = fields[2]
+		default:
+			continue
+		}
+
+		num, err := strconv.ParseUint(fields[0], 0, 12)
+		if err != nil {
+			continue
+		}
+
+		// Versions are written as "introduced-deprecated", optionally
+		// followed by a comma and a base ISA restriction. We only care
+		// about whether the deprecated part is present.
+		rawRange, _ := partition(version, ",")
+		_, deprecated := partition(rawRange, "-")
+
+		ret = append(ret, &CSR{
+			Name:        name,
+			FuncName:    makeIdentUnderscores(name),
+			TypeName:    makeIdentTitle(name),
+			Description: strings.TrimSpace(desc),
+			Num:         bits16(num),
+			Access:      access,
+			ReadOnly:    strings.HasSuffix(access, "ro"),
+			Deprecated:  deprecated != "",
+		})
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Num < ret[j].Num
+	})
+
+	return ret, sc.Err()
 }
 
-func loadOpcodeStrings(filename string) (map[string]string, error) {
-	r, err := os.Open(filename)
+func loadRegisters(fsys fs.FS, filename string) ([]*Register, error) {
+	r, err := openSpecFile(fsys, filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Without the register list we'll just use architectural
+			// register names everywhere.
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ret []*Register
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := trimComments(sc.Text())
+		quot := strings.IndexRune(line, '"')
+		if quot < 0 {
+			continue
+		}
+		fields := strings.Fields(line[:quot])
+		if len(fields) < 4 {
+			continue
+		}
+		desc := line[quot+1:]
+		quot = strings.IndexRune(desc, '"')
+		if quot >= 0 {
+			desc = desc[:quot]
+		}
+
+		name := fields[0]
+		num, err := strconv.Atoi(strings.TrimLeft(name, "xf"))
+		if err != nil {
+			continue
+		}
+
+		ret = append(ret, &Register{
+			Name:        name,
+			ABIName:     fields[1],
+			Num:         num,
+			Type:        ArgType(fields[2]),
+			Save:        fields[3],
+			Description: strings.TrimSpace(desc),
+		})
+	}
+
+	return ret, sc.Err()
+}
+
+func loadOpcodeStrings(fsys fs.FS, filename string) (map[string]string, error) {
+	r, err := openSpecFile(fsys, filename)
 	if err != nil {
 		return nil, err
 	}
 
 	ret := make(map[string]string)
+	lines := make(map[string]int)
 
 	sc := bufio.NewScanner(r)
+	lineNum := 0
 	for sc.Scan() {
+		lineNum++
 		line := trimComments(sc.Text())
 		quot := strings.IndexRune(line, '"')
 		if quot < 0 {
@@ -353,12 +1201,28 @@ func loadOpcodeStrings(filename string) (map[string]string, error) {
 			str = str[:quot]
 		}
 
+		// A duplicate is usually a copy-paste error, so we'll keep the
+		// first entry rather than silently replacing it.
+		if first, ok := lines[mnem]; ok {
+			warnSpec("%s:%d: duplicate entry for %q, already defined on line %d", filename, lineNum, mnem, first)
+			continue
+		}
+		lines[mnem] = lineNum
 		ret[mnem] = strings.TrimSpace(str)
 	}
 
 	return ret, sc.Err()
 }
 
+func hasAttr(attrs []string, want string) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
+
 func trimComments(line string) string {
 	hash := strings.IndexByte(line, '#')
 	if hash == -1 {
@@ -375,25 +1239,68 @@ func partition(s string, sep string) (l, r string) {
 	return s[:idx], s[idx+len(sep):]
 }
 
-func parseMatchSpec(rawSpec string) (val uint32, mask uint32) {
+// parseMatchSpec parses a spec like "6..2=0x1C", giving the value required
+// of a range of bits of an instruction word, and returns that value in
+// position along with the mask of the range. A single bit can be written
+// alone, as in "12=1". Numbers are parsed as for parseSpecNumber. The
+// value "ignore" marks bits that aren't decoded, and so gives zeros for
+// the value and mask, with the range returned as ignore instead.
+func parseMatchSpec(rawSpec string) (val, mask, ignore uint32, err error) {
 	rawRng, rawWant := partition(rawSpec, "=")
-	want, err := strconv.ParseUint(rawWant, 0, 32)
-	if err != nil {
-		return 0, 0
+	if rawRng == "" || rawWant == "" {
+		return 0, 0, 0, fmt.Errorf("invalid match spec %q: must be range=value", rawSpec)
 	}
+
+	// The range is usually written as "end..start", but a single bit can
+	// also be written alone, as just "bit".
 	rawEnd, rawStart := partition(rawRng, "..")
-	start, err := strconv.ParseUint(rawStart, 10, 64)
+	if !strings.Contains(rawRng, "..") {
+		rawStart = rawEnd
+	}
+	start, err := parseSpecNumber(rawStart, 64)
 	if err != nil {
-		return 0, 0
+		return 0, 0, 0, fmt.Errorf("invalid match spec %q: %s", rawSpec, err)
 	}
-	end, err := strconv.ParseUint(rawEnd, 10, 64)
+	end, err := parseSpecNumber(rawEnd, 64)
 	if err != nil {
-		return 0, 0
+		return 0, 0, 0, fmt.Errorf("invalid match spec %q: %s", rawSpec, err)
 	}
-	mask = uint32(rangeMask(uint(end), uint(start)))
+	if end < start {
+		// Tolerate ranges written the other way around.
+		start, end = end, start
+	}
+	if end > 31 {
+		return 0, 0, 0, fmt.Errorf("invalid match spec %q: bit %d is beyond the instruction word", rawSpec, end)
+	}
+	rng := uint32(rangeMask(uint(end), uint(start)))
 
-	// We're just assuming that there won't be a "val" that is too
-	// big to fit in the identified bits here, which means we can ignore
-	// the "end" bit offset altogether.
-	return uint32(want << start), mask
+	if rawWant == "ignore" {
+		return 0, 0, rng, nil
+	}
+	want, err := parseSpecNumber(rawWant, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid match spec %q: %s", rawSpec, err)
+	}
+	if want>>(end-start+1) != 0 {
+		return 0, 0, 0, fmt.Errorf("invalid match spec %q: value does not fit in %d bits", rawSpec, end-start+1)
+	}
+	return uint32(want << start), rng, 0, nil
+}
+
+// parseSpecNumber parses a number from a spec file, which is hexadecimal,
+// binary, or octal if it has a 0x, 0b, or 0o prefix and is decimal
+// otherwise. Underscores may separate the digits. Unlike in a Go literal,
+// a leading zero doesn't mean octal, so that "011" is eleven rather than
+// nine.
+func parseSpecNumber(raw string, bitSize int) (uint64, error) {
+	if len(raw) > 2 && raw[0] == '0' {
+		switch raw[1] {
+		case 'x', 'X', 'b', 'B', 'o', 'O':
+			return strconv.ParseUint(raw, 0, bitSize)
+		}
+	}
+	if strings.HasPrefix(raw, "_") || strings.HasSuffix(raw, "_") || strings.Contains(raw, "__") {
+		return 0, fmt.Errorf("misplaced digit separator in %q", raw)
+	}
+	return strconv.ParseUint(strings.Replace(raw, "_", "", -1), 10, bitSize)
 }
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// loadTestISA loads the committed spec files at the root of the repository,
+// through a file system rooted there so that the working directory is left
+// alone.
+func loadTestISA(t *testing.T) *ISA {
+	t.Helper()
+	specWarnings = nil
+	isa, err := loadISAMeta(loadOptions{SpecFS: os.DirFS("..")})
+	if err != nil {
+		t.Fatalf("failed to load spec: %s", err)
+	}
+	return isa
+}
+
+// findTestOp returns the first loaded operation with the given name, or nil
+// if there is none.
+func findTestOp(isa *ISA, name string) *Operation {
+	for i := range isa.Ops {
+		if isa.Ops[i].Name == name {
+			return &isa.Ops[i]
+		}
+	}
+	return nil
+}
+
+func TestLoadSpec(t *testing.T) {
+	isa := loadTestISA(t)
+
+	// The spec has about 280 operations, so a count well below that means
+	// that a bad edit has dropped some of them.
+	const minOps = 250
+	if got := len(isa.Ops); got < minOps {
+		t.Errorf("loaded only %d operations; want at least %d", got, minOps)
+	}
+
+	for _, msg := range isa.LoadWarnings {
+		if strings.Contains(msg, "no known codec") {
+			t.Errorf("operation dropped: %s", msg)
+		}
+	}
+
+	// These are a sample of base ISA operations with their well-known
+	// encodings, to catch an edit to a shared entry that changes them.
+	coreOps := []struct {
+		Name       string
+		Test, Mask bits32
+	}{
+		{"addi", 0x00000013, 0x0000707f},
+		{"add", 0x00000033, 0xfe00707f},
+		{"lw", 0x00002003, 0x0000707f},
+		{"sw", 0x00002023, 0x0000707f},
+		{"beq", 0x00000063, 0x0000707f},
+		{"jal", 0x0000006f, 0x0000007f},
+	}
+	for _, want := range coreOps {
+		t.Run(want.Name, func(t *testing.T) {
+			op := findTestOp(isa, want.Name)
+			if op == nil {
+				t.Fatalf("operation is missing")
+			}
+			if op.Test != want.Test || op.Mask != want.Mask {
+				t.Errorf("wrong encoding\ngot:  0x%08x/0x%08x\nwant: 0x%08x/0x%08x", uint32(op.Test), uint32(op.Mask), uint32(want.Test), uint32(want.Mask))
+			}
+		})
+	}
+}
+
+func TestParseMatchSpec(t *testing.T) {
+	tests := []struct {
+		spec       string
+		wantVal    uint32
+		wantMask   uint32
+		wantIgnore uint32
+		wantErr    bool
+	}{
+		{"6..2=0x1C", 0x70, 0x7c, 0, false},
+		{"14..12=5", 0x5000, 0x7000, 0, false},
+		{"2..6=0x1C", 0x70, 0x7c, 0, false},
+		{"12=1", 0x1000, 0x1000, 0, false},
+		{"12=0", 0, 0x1000, 0, false},
+		{"0=1", 0x1, 0x1, 0, false},
+		{"31=1", 0x80000000, 0x80000000, 0, false},
+		{"31..28=ignore", 0, 0, 0xf0000000, false},
+		{"20=ignore", 0, 0, 0x100000, false},
+		{"32..28=ignore", 0, 0, 0, true},
+		{"6..0=0x33", 0x33, 0x7f, 0, false},
+		{"6..0=0b011_0011", 0x33, 0x7f, 0, false},
+		{"14..12=0b1_0", 0x2000, 0x7000, 0, false},
+		{"6..2=1_1", 0x2c, 0x7c, 0, false},
+		{"6..2=011", 0x2c, 0x7c, 0, false},
+		{"6..2=_1", 0, 0, 0, true},
+		{"6..2=1__1", 0, 0, 0, true},
+		{"12=2", 0, 0, 0, true},
+		{"32=1", 0, 0, 0, true},
+		{"=1", 0, 0, 0, true},
+		{"12=", 0, 0, 0, true},
+		{"12", 0, 0, 0, true},
+		{"6..=1", 0, 0, 0, true},
+		{"x..2=1", 0, 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			val, mask, ignore, err := parseMatchSpec(test.spec)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success; want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if val != test.wantVal || mask != test.wantMask || ignore != test.wantIgnore {
+				t.Errorf("wrong result\ngot:  val 0x%08x mask 0x%08x ignore 0x%08x\nwant: val 0x%08x mask 0x%08x ignore 0x%08x", val, mask, ignore, test.wantVal, test.wantMask, test.wantIgnore)
+			}
+		})
+	}
+}
+
+func TestParseSpecNumber(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    uint64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"33", 33, false},
+		{"0x33", 0x33, false},
+		{"0X1c", 0x1c, false},
+		{"0b10", 2, false},
+		{"0b1_0", 2, false},
+		{"0o17", 15, false},
+		{"1_1", 11, false},
+		{"011", 11, false},
+		{"0x", 0, true},
+		{"_1", 0, true},
+		{"1_", 0, true},
+		{"1__1", 0, true},
+		{"0b12", 0, true},
+		{"-1", 0, true},
+		{"", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			got, err := parseSpecNumber(test.raw, 32)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success; want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("wrong result\ngot:  %d\nwant: %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadImplicitOperands(t *testing.T) {
+	isa := loadTestISA(t)
+
+	tests := []struct {
+		name string
+		role string
+		want int
+	}{
+		{"c.mv", "rs1", 0},
+		{"c.nop", "rd", 0},
+		{"c.nop", "rs1", 0},
+		{"c.li", "rs1", 0},
+		{"c.jal", "rd", 1},
+		{"c.lwsp", "rs1", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name+" "+test.role, func(t *testing.T) {
+			op := findTestOp(isa, test.name)
+			if op == nil {
+				t.Fatalf("operation is missing")
+			}
+			got, ok := op.ImplicitReg(test.role)
+			if !ok {
+				t.Fatalf("no implicit %s", test.role)
+			}
+			if got != test.want {
+				t.Errorf("implicit %s is x%d; want x%d", test.role, got, test.want)
+			}
+		})
+	}
+
+	// The implicit source of c.mv must not hide its encoded operands.
+	op := isa.Decode(0x852e, RV32)
+	if got, want := formatInstruction(isa, op, 0x852e, RV32), "c.mv a0, a1"; got != want {
+		t.Errorf("wrong disassembly %q; want %q", got, want)
+	}
+}
+
+func TestLoadConstraints(t *testing.T) {
+	isa := loadTestISA(t)
+	addi := findTestOp(isa, "addi")
+	if addi == nil {
+		t.Fatal("no operation addi")
+	}
+	fsys := fstest.MapFS{
+		"constraints": {Data: []byte(strings.Join([]string{
+			"# made-up constraints, to exercise each form",
+			"addi rd%2=0 rs1!=0",
+			"addi rd%4!=2",
+			"addi rd%0=0",
+			"addi nonexistent=1",
+			"",
+		}, "\n"))},
+	}
+
+	specWarnings = nil
+	ops := []Operation{*addi}
+	ops[0].Constraints = nil
+	if err := loadConstraints(fsys, "constraints", ops, isa.Arguments); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(specWarnings), 2; got != want {
+		t.Errorf("got %d warnings %q; want %d for the invalid modulus and the unknown operand", got, specWarnings, want)
+	}
+
+	var got []string
+	for _, cond := range ops[0].Constraints {
+		got = append(got, fmt.Sprintf("%s %%%d =%d not=%t", cond.Arg.Name, cond.Modulus, cond.Value, cond.NotEqual))
+	}
+	want := []string{
+		"rd %2 =0 not=false",
+		"rs1 %0 =0 not=true",
+		"rd %4 =2 not=true",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong constraints\ngot:  %q\nwant: %q", got, want)
+	}
+
+	// addi rd, rs1, 0
+	word := func(rd, rs1 bits32) bits32 {
+		return rs1<<15 | rd<<7 | 0x13
+	}
+	validTests := []struct {
+		rd, rs1 bits32
+		want    bool
+	}{
+		{4, 1, true},
+		{8, 31, true},
+		{3, 1, false}, // rd%2 != 0
+		{4, 0, false}, // rs1 == 0
+		{6, 1, false}, // rd%4 == 2
+	}
+	for _, test := range validTests {
+		if got := ops[0].Valid(word(test.rd, test.rs1), RV32); got != test.want {
+			t.Errorf("addi x%d, x%d, 0: Valid returned %t; want %t", test.rd, test.rs1, got, test.want)
+		}
+	}
+}
+
+func TestLoadDuplicateKeys(t *testing.T) {
+	fsys := fstest.MapFS{
+		"opcode-descriptions": {Data: []byte(strings.Join([]string{
+			"# descriptions",
+			`addi       "Add immediate"`,
+			`slti       "Set less than immediate"`,
+			`addi       "Set less than immediate"`,
+			"",
+		}, "\n"))},
+		"compression": {Data: []byte(strings.Join([]string{
+			"# expansions",
+			"c.addi     addi",
+			"c.li       addi",
+			"c.addi     slti",
+			"",
+		}, "\n"))},
+	}
+
+	tests := []struct {
+		filename  string
+		load      func() (map[string]string, error)
+		key, want string
+	}{
+		{
+			"opcode-descriptions",
+			func() (map[string]string, error) { return loadOpcodeStrings(fsys, "opcode-descriptions") },
+			"addi", "Add immediate",
+		},
+		{
+			"compression",
+			func() (map[string]string, error) { return loadExpansions(fsys, "compression") },
+			"c.addi", "addi",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			specWarnings = nil
+			got, err := test.load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 2 {
+				t.Errorf("got %d entries; want 2", len(got))
+			}
+
+			// The first entry is kept, since the duplicate is more
+			// likely to be the copy-paste error.
+			if got[test.key] != test.want {
+				t.Errorf("%s is %q; want %q", test.key, got[test.key], test.want)
+			}
+
+			if len(specWarnings) != 1 {
+				t.Fatalf("got warnings %q; want one for the duplicate", specWarnings)
+			}
+			if want := test.filename + ":4: "; !strings.HasPrefix(specWarnings[0], want) {
+				t.Errorf("warning %q doesn't start with %q", specWarnings[0], want)
+			}
+			if !strings.Contains(specWarnings[0], "already defined on line 2") {
+				t.Errorf("warning %q doesn't refer to the first definition", specWarnings[0])
+			}
+		})
+	}
+}
+
+func TestLoadMajorOpcodesResetsSkipped(t *testing.T) {
+	fsys := fstest.MapFS{
+		"first":  {Data: []byte("6..5=0 4..2=2 custom-0\n6..5=0 4..2=0 LOAD\n")},
+		"second": {Data: []byte("6..5=0 4..2=0 LOAD\n")},
+	}
+
+	if _, err := loadMajorOpcodes(fsys, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := skippedMajorOpcodes[0b0001011]; !ok {
+		t.Fatalf("custom-0 was not recorded as skipped")
+	}
+	if _, err := loadMajorOpcodes(fsys, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if skipped, ok := skippedMajorOpcodes[0b0001011]; ok {
+		t.Errorf("%s is still recorded as skipped after loading a file without it", skipped.Name)
+	}
+}
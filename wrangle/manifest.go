@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// manifestFilename is the name of the manifest that runBackends writes
+// into the output directory.
+const manifestFilename = "manifest.json"
+
+// manifest describes a run of the code generators, so that build tools can
+// track which files it declared as outputs and whether they are stale. The
+// input directory and the paths of the generated files are relative to the
+// directory containing the manifest, so that the manifest stays valid if
+// the whole tree is moved.
+type manifest struct {
+	InDir      string         `json:"indir"`
+	SpecFiles  []string       `json:"spec_files"`
+	Extensions []string       `json:"extensions"`
+	Files      []manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	Path    string `json:"path"`
+	Backend string `json:"backend"`
+	SHA256  string `json:"sha256"`
+}
+
+// writeManifest writes the manifest of a run of the code generators into
+// the given directory, listing the files created by each of the given
+// backends, in order, as recorded in files.
+func writeManifest(dir string, isa *ISA, backends []string, files map[string][]string) error {
+	inDir, err := manifestPath(dir, ".")
+	if err != nil {
+		return err
+	}
+	m := manifest{
+		InDir:      inDir,
+		SpecFiles:  sortedUnique(specFilesRead),
+		Extensions: manifestExtensions(isa),
+		Files:      []manifestFile{},
+	}
+
+	for _, backend := range backends {
+		for _, filename := range files[backend] {
+			src, err := os.ReadFile(filename)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(src)
+			path, err := manifestPath(dir, filename)
+			if err != nil {
+				return err
+			}
+			m.Files = append(m.Files, manifestFile{
+				Path:    path,
+				Backend: backend,
+				SHA256:  hex.EncodeToString(sum[:]),
+			})
+		}
+	}
+
+	w, err := createOutputFile(filepath.Join(dir, manifestFilename))
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("failed to write manifest: %s", err)
+	}
+	return w.Close()
+}
+
+// manifestPath returns the given path, which is relative to the current
+// working directory, as a slash-separated path relative to the directory
+// that the manifest is written into.
+func manifestPath(dir, path string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// manifestExtensions returns the letters of the extensions that have at
+// least one operation in the ISA, after any filtering.
+func manifestExtensions(isa *ISA) []string {
+	var ret []string
+	for _, op := range isa.Ops {
+		for _, ext := range op.Standards.Extensions() {
+			ret = append(ret, ext.String())
+		}
+	}
+	return sortedUnique(ret)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunBackendsManifest(t *testing.T) {
+	isa := loadTestISA(t)
+	dir := t.TempDir()
+	if err := runBackends(dir, []string{"go", "cpp"}, isa, NamePascal); err != nil {
+		t.Fatalf("failed to generate: %s", err)
+	}
+
+	src, err := os.ReadFile(filepath.Join(dir, manifestFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(src, &m); err != nil {
+		t.Fatalf("invalid manifest: %s", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.IsAbs(m.InDir) {
+		t.Errorf("indir %q is absolute; want it relative to the output directory", m.InDir)
+	}
+	if got := filepath.Join(dir, filepath.FromSlash(m.InDir)); got != wd {
+		t.Errorf("indir %q resolves to %s; want %s", m.InDir, got, wd)
+	}
+
+	var got []string
+	for _, f := range m.Files {
+		got = append(got, f.Backend+" "+f.Path)
+	}
+	want := []string{
+		"go go/decode.go",
+		"go go/raw_instruction.go",
+		"go go/stream.go",
+		"go go/decode_test.go",
+		"cpp cpp/riscv.hpp",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong files\ngot:  %q\nwant: %q", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"os"
+)
+
+// outputFile is a file of generated code. Writes are buffered, and the
+// buffer retains the first write error and ignores any later writes, so
+// generators need not check the result of each write. Instead, they must
+// call Close and return its error, which reports any write error.
+type outputFile struct {
+	*bufio.Writer
+
+	f      *os.File
+	closed bool
+	err    error
+}
+
+func createOutputFile(filename string) (*outputFile, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{
+		Writer: bufio.NewWriter(f),
+		f:      f,
+	}, nil
+}
+
+// Close flushes any buffered output and closes the file, returning the
+// first error encountered while writing, flushing, or closing. Only the
+// first call has any effect, so it's safe to both defer Close to handle
+// early returns and call it explicitly to check for errors.
+func (o *outputFile) Close() error {
+	if o.closed {
+		return o.err
+	}
+	o.closed = true
+
+	o.err = o.Flush()
+	if err := o.f.Close(); o.err == nil {
+		o.err = err
+	}
+	return o.err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputFileCloseReportsWriteError(t *testing.T) {
+	// Writes to /dev/full always fail as if the disk were full, which is
+	// the situation where a generator could otherwise leave a truncated
+	// file without reporting any error.
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full on this system")
+	}
+	f, err := createOutputFile("/dev/full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newErrWriter(f)
+	for i := 0; i < 1000; i++ {
+		w.WriteString("// generated line that doesn't fit\n")
+	}
+
+	if err := f.Close(); err == nil {
+		t.Fatal("Close succeeded; want the error from writing")
+	}
+	if err := f.Close(); err == nil {
+		t.Fatal("second Close succeeded; want the same error again")
+	}
+}
+
+func TestOutputFileClose(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "out.txt")
+	f, err := createOutputFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello\n")
+	if err := f.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello\n" {
+		t.Errorf("wrong content %q; want %q", got, "hello\n")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// phaseTimer reports how long each of a sequence of phases takes, on
+// stderr, when the -profile option is set. It does nothing otherwise.
+type phaseTimer struct {
+	name  string
+	start time.Time
+}
+
+// startPhase begins timing the first of a sequence of phases. An empty
+// name starts the sequence without timing anything until the first call
+// to Next.
+func startPhase(name string) *phaseTimer {
+	return &phaseTimer{name: name, start: time.Now()}
+}
+
+// Next reports the time taken by the current phase and begins timing the
+// next one.
+func (t *phaseTimer) Next(name string) {
+	t.Stop()
+	t.name = name
+	t.start = time.Now()
+}
+
+// Stop reports the time taken by the current phase, if it hasn't already
+// been reported.
+func (t *phaseTimer) Stop() {
+	if t.name == "" {
+		return
+	}
+	if *profile {
+		fmt.Fprintf(os.Stderr, "%-36s %s\n", t.name, time.Since(t.start))
+	}
+	t.name = ""
+}
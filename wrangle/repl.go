@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `Enter an instruction word to decode it, or one of the following commands:
+  :op <name>     show the details of the named operation
+  :base <size>   decode as RV32, RV64, or RV128 (currently RV%d)
+  :help          show this message
+
+Instruction words are hexadecimal by default, or may be given with an
+explicit 0x or 0b prefix. Words whose two low-order bits are not both set
+are decoded as 16-bit compressed instructions.
+`
+
+func runREPL(r io.Reader, w io.Writer, isa *ISA) error {
+	size := RV64
+	c := terminalColors(w)
+
+	sc := bufio.NewScanner(r)
+	fmt.Fprint(w, "> ")
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		cmd, arg := partition(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch cmd {
+		case "":
+			// Ignore blank lines.
+		case ":help":
+			fmt.Fprintf(w, replHelp, int(size))
+		case ":op":
+			found := false
+			for i := range isa.Ops {
+				op := &isa.Ops[i]
+				if op.Name != arg {
+					continue
+				}
+				printOperation(w, isa, op, c)
+				found = true
+			}
+			if !found {
+				fmt.Fprintf(w, "no operation named %q\n", arg)
+			}
+		case ":base":
+			switch strings.TrimPrefix(strings.ToUpper(arg), "RV") {
+			case "32":
+				size = RV32
+			case "64":
+				size = RV64
+			case "128":
+				size = RV128
+			default:
+				fmt.Fprintf(w, "invalid base ISA %q; must be RV32, RV64, or RV128\n", arg)
+			}
+		default:
+			word, err := parseInstructionWord(line)
+			if err != nil {
+				fmt.Fprintf(w, "invalid instruction word %q: %s\n", line, err)
+				break
+			}
+			if instructionLength(word) == 2 {
+				word &= 0xffff
+			}
+			result := isa.DecodeExplain(word, size)
+			if result.Outcome != DecodeOK {
+				fmt.Fprintf(w, "%s: not a valid RV%d instruction (%s format)\n", word, int(size), isa.ClassifyFormat(word))
+				fmt.Fprintf(w, "  %s\n", result)
+				break
+			}
+			fmt.Fprintln(w, colorInstruction(formatInstruction(isa, result.Op, word, size), c))
+		}
+
+		fmt.Fprint(w, "> ")
+	}
+	fmt.Fprintln(w)
+
+	return sc.Err()
+}
+
+func parseInstructionWord(raw string) (bits32, error) {
+	raw = strings.ToLower(raw)
+	base := 16
+	if strings.HasPrefix(raw, "0x") || strings.HasPrefix(raw, "0b") {
+		base = 0
+	}
+	v, err := strconv.ParseUint(raw, base, 32)
+	if err != nil {
+		// The strconv error includes the input, which we already report.
+		return 0, err.(*strconv.NumError).Err
+	}
+	return bits32(v), nil
+}
+
+// colorInstruction highlights the mnemonic and operands of an instruction
+// as formatted by formatInstruction.
+func colorInstruction(s string, c colors) string {
+	name, rest := partition(s, " ")
+	if rest == "" {
+		return c.Mnemonic(name)
+	}
+	operands := strings.Split(rest, ", ")
+	for i, operand := range operands {
+		operands[i] = c.Operand(operand)
+	}
+	return c.Mnemonic(name) + " " + strings.Join(operands, ", ")
+}
+
+func printOperation(w io.Writer, isa *ISA, op *Operation, c colors) {
+	fmt.Fprintf(w, "%s", c.Mnemonic(op.Name))
+	if op.FullName != "" {
+		fmt.Fprintf(w, ": %s", op.FullName)
+	}
+	fmt.Fprintln(w)
+	if op.Description != "" {
+		fmt.Fprintf(w, "  %s\n", op.Description)
+	}
+	fmt.Fprintf(w, "  standards:  %s\n", op.Standards)
+	fmt.Fprintf(w, "  codec:      %s (%s)\n", op.Codec.Name, op.Codec.Format)
+	fmt.Fprintf(w, "  operands:   %s\n", strings.Join(op.Codec.Operands, ", "))
+	if len(op.Implicit) != 0 {
+		implicit := make([]string, len(op.Implicit))
+		for i, imp := range op.Implicit {
+			implicit[i] = fmt.Sprintf("%s=%s", imp.Role, isa.RegisterName(ArgIntReg, imp.Reg, *regNames == "abi"))
+		}
+		fmt.Fprintf(w, "  implicit:   %s\n", strings.Join(implicit, ", "))
+	}
+	if len(op.Attrs) != 0 {
+		var attrs []string
+		for attr := range op.Attrs {
+			attrs = append(attrs, attr)
+		}
+		fmt.Fprintf(w, "  attributes: %s\n", strings.Join(sortedUnique(attrs), ", "))
+	}
+	fixed, operands := op.FixedMask(), op.OperandMask(isa)
+	fmt.Fprintf(w, "  test:       %s\n", c.Bits(op.Test, fixed, operands))
+	fmt.Fprintf(w, "  mask:       %s\n", c.Bits(op.Mask, fixed, operands))
+	fmt.Fprintf(w, "  encoding:   %s\n", op.EncodingString(isa))
+	if op.Pseudocode != "" {
+		fmt.Fprintf(w, "  pseudocode: %s\n", op.Pseudocode)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// roundtripPatterns are the operand values that checkRoundtrip tries to
+// assemble, each of which is first truncated to a value that the operand
+// can represent.
+var roundtripPatterns = []int64{1, -1, 0x55555555, 0x2aaaaaaa}
+
+// checkRoundtrip assembles each operation in the RV32 and RV64 base ISAs
+// with several operand values, and then disassembles the resulting words
+// to verify that they produce the same operation and operand values. It
+// returns a description of each failure.
+func checkRoundtrip(isa *ISA) []string {
+	var problems []string
+
+	for _, size := range []Size{RV32, RV64} {
+		anyStd := size.Any()
+		for i := range isa.Ops {
+			op := &isa.Ops[i]
+			if !op.Standards.Has(anyStd) {
+				continue
+			}
+			for _, pattern := range roundtripPatterns {
+				if problem := roundtripOperation(isa, op, size, pattern); problem != "" {
+					problems = append(problems, fmt.Sprintf("%s (%s): %s", op.Name, anyStd, problem))
+					break
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// roundtripOperation assembles the given operation with all of its
+// operands derived from the given pattern and checks that the result
+// disassembles to the same thing, returning a description of the problem
+// if not.
+func roundtripOperation(isa *ISA, op *Operation, size Size, pattern int64) string {
+	word := op.Test
+	want := make([]int64, len(op.Codec.Operands))
+	for i, argName := range op.Codec.Operands {
+		arg := isa.Argument(argName, size)
+
+		// An operand whose bits are all fixed by the encoding, such as
+		// the stack pointer operand of c.addi16sp, can have only the one
+		// value the encoding implies.
+		if argMask := arg.Mask(); argMask&op.Mask == argMask {
+			want[i] = arg.Decode(op.Test)
+			continue
+		}
+
+		v := arg.Decode(arg.Encode(pattern))
+		bits := arg.Encode(v)
+		if overlap := bits & op.Mask; overlap != 0 {
+			return fmt.Sprintf("operand %s encodes into fixed bits %s", arg.Name, overlap)
+		}
+		want[i] = v
+		word |= bits
+	}
+
+	// Some operand values are reserved, and the assembler wouldn't
+	// produce them, so they don't indicate a problem.
+	if !op.Valid(word, size) {
+		return ""
+	}
+
+	got := isa.Decode(word, size)
+	switch {
+	case got == nil:
+		return fmt.Sprintf("word %s does not decode", word)
+	case got != op:
+		// Some operand values select a more specific operation, such as a
+		// HINT or a pseudo-operation, which is also not a problem as long
+		// as that operation fixes some of the operand bits.
+		if got.Specificity() > op.Specificity() {
+			return ""
+		}
+		return fmt.Sprintf("word %s decodes as %s", word, got.Name)
+	}
+
+	for i, argName := range op.Codec.Operands {
+		arg := isa.Argument(argName, size)
+		if v := arg.Decode(word); v != want[i] {
+			return fmt.Sprintf("word %s decodes operand %s as %d, but %d was encoded", word, arg.Name, v, want[i])
+		}
+	}
+	return ""
+}
+
+func printRoundtripProblems(w io.Writer, isa *ISA) error {
+	problems := checkRoundtrip(isa)
+	for _, problem := range problems {
+		fmt.Fprintln(w, problem)
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("%d operations failed to round-trip", len(problems))
+	}
+	return nil
+}
@@ -2,100 +2,260 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"log"
+	"math/bits"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 )
 
-func generateRustFragments(dir string, isa *ISA) error {
+// codeWriter is the interface of the destinations for generated code.
+type codeWriter interface {
+	io.Writer
+	io.StringWriter
+}
+
+// rustFragment is one of the files of generated Rust code.
+type rustFragment struct {
+	Filename string
+
+	// DefinesTypes is true if the fragment defines any types, and so
+	// needs the serde imports when the -serde option is set.
+	DefinesTypes bool
+
+	Write func(w *errWriter) error
+}
+
+func generateRustFragments(dir string, isa *ISA, style NameStyle) ([]string, error) {
 	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	fragments := []rustFragment{
+		{"opcode.rs", true, func(w *errWriter) error { return writeRustOpcode(w, isa.MajorOpcodes, style) }},
+		{"register_names.rs", true, func(w *errWriter) error { return writeRustRegisterNames(w, isa, *regNames == "abi") }},
+		{"raw_instruction.rs", true, func(w *errWriter) error { return writeRustRawInstruction(w, isa.Arguments) }},
+		{"ordering.rs", true, func(w *errWriter) error { return writeRustOrdering(w) }},
+		{"instruction.rs", true, func(w *errWriter) error { return writeRustInstruction(w, isa, style) }},
+		{"dispatch.rs", false, func(w *errWriter) error { return writeRustDispatchArray(w, isa, style) }},
+		{"compressed.rs", false, func(w *errWriter) error { return writeRustCompressedDecode(w, isa, style) }},
+		{"exec32.rs", false, func(w *errWriter) error { return writeRustExec(w, isa, RV32, style) }},
+		{"csr.rs", true, func(w *errWriter) error { return writeRustCSRs(w, isa.CSRs, style) }},
+		{"operation_kind.rs", true, func(w *errWriter) error { return writeRustOperationKind(w, isa, style) }},
+		{"instruction_trait.rs", false, func(w *errWriter) error { return writeRustInstructionTrait(w, isa, style) }},
+	}
+	if *noCompressed {
+		var uncompressed []rustFragment
+		for _, frag := range fragments {
+			if frag.Filename != "compressed.rs" {
+				uncompressed = append(uncompressed, frag)
+			}
+		}
+		fragments = uncompressed
+	}
+	if *splitBy == "extension" {
+		// The split enums replace instruction.rs, and the other fragments
+		// that refer to the operation enums adapt to them by way of
+		// rustDecodeTarget.
+		var unsplit []rustFragment
+		for _, frag := range fragments {
+			if frag.Filename != "instruction.rs" {
+				unsplit = append(unsplit, frag)
+			}
+		}
+		fragments = append(unsplit, rustExtensionFragments(isa, style)...)
+	}
+
+	var created []string
+	timer := startPhase("")
+	if *singleFile {
+		timer.Next("generate rust riscv.rs")
+		filename := filepath.Join(dir, "riscv.rs")
+		err = generateRustSingleFile(filename, fragments)
+		if err == nil {
+			created = append(created, filename)
+		}
+	} else {
+		for _, frag := range fragments {
+			timer.Next("generate rust " + frag.Filename)
+			filename := filepath.Join(dir, frag.Filename)
+			err = generateRustFragment(filename, frag)
+			if err != nil {
+				break
+			}
+			created = append(created, filename)
+		}
+	}
+	timer.Stop()
+	if err != nil {
+		return created, err
+	}
+
+	if *verbose {
+		logGeneratedSummary(isa, []Size{RV32, RV64})
+	}
+
+	return created, nil
+}
+
+func generateRustFragment(filename string, frag rustFragment) error {
+	w, err := createOutputFile(filename)
 	if err != nil {
 		return err
 	}
+	defer w.Close()
 
-	err = generateRustOpcode(filepath.Join(dir, "opcode.rs"), isa.MajorOpcodes)
-	err = generateRustRawInstruction(filepath.Join(dir, "raw_instruction.rs"), isa.Arguments)
-	err = generateRustInstruction(filepath.Join(dir, "instruction.rs"), isa)
-	err = generateRustExec(filepath.Join(dir, "exec32.rs"), isa, RV32)
+	ew := newErrWriter(newIndentWriter(w))
+	writeFileHeader(ew, rustComments)
+	if frag.DefinesTypes {
+		writeRustSerdeHeader(ew)
+	}
+	err = frag.Write(ew)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
 
-	return nil
+// writeRustSerdeHeader writes the imports needed by the serde derives, if
+// the -serde option is set.
+func writeRustSerdeHeader(w *errWriter) {
+	if !*serde {
+		return
+	}
+	w.WriteString("// The types in this module implement Serialize and Deserialize, which\n")
+	w.WriteString("// requires the serde crate with its \"derive\" feature enabled. The\n")
+	w.WriteString("// IntRegister and FloatRegister types must implement them too.\n")
+	w.WriteString("use serde::{Deserialize, Serialize};\n\n")
 }
 
-func generateRustOpcode(filename string, ops map[bits8]*MajorOpcode) error {
-	w, err := os.Create(filename)
+// generateRustSingleFile writes all of the given fragments into a single
+// module, for consumers that would rather vendor just one file. The module
+// imports everything from its parent so that the generated code can still
+// refer to the types that the consuming crate must define, such as
+// IntRegister.
+func generateRustSingleFile(filename string, fragments []rustFragment) error {
+	w, err := createOutputFile(filename)
 	if err != nil {
 		return err
 	}
+	defer w.Close()
 
-	opsList := make([]*MajorOpcode, 0, len(ops))
-	for _, op := range ops {
-		opsList = append(opsList, op)
+	ew := newErrWriter(newIndentWriter(w))
+	writeFileHeader(ew, rustComments)
+	ew.WriteString("pub mod riscv {\n")
+	ew.WriteString("use super::*;\n")
+	writeRustSerdeHeader(ew)
+	for _, frag := range fragments {
+		ew.WriteString("\n")
+		rustComments.WriteComment(ew, "---- "+frag.Filename+" ----")
+		ew.WriteString("\n")
+		err := frag.Write(ew)
+		if err != nil {
+			return fmt.Errorf("%s: %s", frag.Filename, err)
+		}
+	}
+	ew.WriteString("\n}\n")
+	if err := ew.Err(); err != nil {
+		return err
 	}
-	sort.Slice(opsList, func(i, j int) bool {
-		return opsList[i].TypeName < opsList[j].TypeName
-	})
+
+	return w.Close()
+}
+
+func writeRustOpcode(w *errWriter, ops map[bits8]*MajorOpcode, style NameStyle) error {
+	opsList := sortedMajorOpcodes(ops)
 
 	w.WriteString("/// Enumeration of top-level opcodes for full-length operations.\n")
-	w.WriteString("pub enum Opcode: u8 {\n")
+	w.WriteString(rustDeriveAttr())
+	w.WriteString("#[repr(u8)]\n")
+	w.WriteString("pub enum Opcode {\n")
 	for _, op := range opsList {
-		fmt.Fprintf(w, "    %s = 0b%07b,\n", op.TypeName, op.Num)
+		w.Printf("    %s = 0b%07b,\n", style.RustIdent(op.Name), op.Num)
 	}
 	w.WriteString("}\n")
 
-	return nil
+	return w.Err()
 }
 
-func generateRustRawInstruction(filename string, args map[string]*Argument) error {
-	w, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-
+func writeRustRawInstruction(w *errWriter, args map[string]*Argument) error {
 	w.WriteString("/// Represents a raw RISC-V instruction word that is yet to be decoded.\n")
 	w.WriteString("///\n")
 	w.WriteString("/// It can represent both standard-length and compressed instructions, the\n")
 	w.WriteString("/// latter of which are supported by ignoring the higher-order parcel.\n")
+	w.WriteString(rustDeriveAttr())
 	w.WriteString("pub struct RawInstruction (u32);\n")
 	w.WriteString("\n")
+
+	argEncodings := sortedArgEncodings(args)
+
+	// The masks for each argument are named constants so that a change
+	// to one field is easy to see in a diff, and so that consumers can
+	// reuse them.
+	for _, arg := range argEncodings {
+		for i, step := range arg.Decoding {
+			w.Printf("/// %s\n", step.Describe(arg.Name))
+			w.Printf("pub const %s: u32 = 0x%08x;\n", arg.MaskConstName(i, NameSnake), uint32(step.Mask))
+		}
+	}
+	w.WriteString("\n")
 	w.WriteString("impl RawInstruction {\n")
+	w.WriteString("    // The accessors borrow self rather than taking it by value, so that\n")
+	w.WriteString("    // they don't rely on RawInstruction being Copy and can keep the same\n")
+	w.WriteString("    // signatures on instruction types that might not be.\n")
 	w.WriteString("\n")
+	w.WriteString("    /// Returns true if the bits of the instruction selected by mask are\n")
+	w.WriteString("    /// equal to test, which is how the decoders identify operations.\n")
+	w.Printf("    pub %s matches(&self, mask: u32, test: u32) -> bool {\n", rustConstFn())
+	w.WriteString("        (self.0 & mask) == test\n")
+	w.WriteString("    }\n")
+	w.WriteString("\n")
+
+	// First we'll include accessors for the fields that are in the same
+	// position for all of the standard-length encodings. These are all
+	// narrow enough to fit in u8, which also matches the representation
+	// of the Opcode enum. Some of these have the same names as operands,
+	// so we add a suffix to distinguish the raw field values from the
+	// typed operand values.
+	for _, field := range fixedFields {
+		name := field.Name
+		if _, isArg := args[name]; isArg {
+			name += "_field"
+		}
+		w.Printf("    /// Returns the raw value of bits %d:%d, regardless of encoding.\n", field.Hi, field.Lo)
+		w.Printf("    pub %s %s(&self) -> u8 {\n", rustConstFn(), name)
+		w.Printf("        ((self.0 >> %d) & 0b%b) as u8\n", field.Lo, uint32(rangeMask(field.Hi-field.Lo, 0)))
+		w.WriteString("    }\n")
+		w.WriteString("\n")
+	}
 
 	// We'll include a method for each of the distinct argument types. It's
 	// the responsibility of the caller to only call the methods appropriate
 	// for a given instruction type, since otherwise the results will just
 	// be garbage.
 
-	var argNames []string
-	for _, arg := range args {
-		argNames = append(argNames, arg.Name)
-	}
-	sort.Strings(argNames)
-
-	for _, name := range argNames {
-		arg := args[name]
-		resultTy := rustTypeForArgType(arg.Type, arg.EncWidth)
-		fmt.Fprintf(w, "    pub fn %s(&self) -> %s {\n", arg.FuncName, resultTy)
+	for _, arg := range argEncodings {
+		resultTy := rustTypeForArg(arg)
+		writeRustArgDoc(w, arg, resultTy)
+		fn := "fn"
+		switch resultTy {
+		case "u32", "bool", "Ordering":
+			// The others call functions that the consuming crate
+			// defines, which might not be const.
+			fn = rustConstFn()
+		}
+		w.Printf("    pub %s %s(&self) -> %s {\n", fn, arg.FuncName, resultTy)
 		if resultTy == "i32" {
-			fmt.Fprintf(w, "        let width = %d;\n", arg.EncWidth)
+			w.Printf("        let width = %d;\n", arg.EncWidth)
 		}
 		if resultTy == "bool" && len(arg.Decoding) == 1 {
 			// Simpler case for a single flag bit.
-			fmt.Fprintf(w, "        return (self.0 & 0b%032b) != 0;\n", arg.Decoding[0].Mask)
+			w.Printf("        return (self.0 & %s) != 0;\n", arg.MaskConstName(0, NameSnake))
 		} else {
-			w.WriteString("        let mut raw: u32 = 0;\n")
-			for _, step := range arg.Decoding {
-				switch {
-				case step.RightShift == 0:
-					fmt.Fprintf(w, "        // Fill 0b%032b\n", step.Mask)
-					fmt.Fprintf(w, "        raw |= (self.0 & 0b%032b);\n", step.Mask)
-				case step.RightShift < 0:
-					fmt.Fprintf(w, "        // Fill 0b%032b\n", step.Mask<<-step.RightShift)
-					fmt.Fprintf(w, "        raw |= (self.0 & 0b%032b) << %d;\n", step.Mask, -step.RightShift)
-				default:
-					fmt.Fprintf(w, "        // Fill 0b%032b\n", step.Mask>>step.RightShift)
-					fmt.Fprintf(w, "        raw |= (self.0 & 0b%032b) >> %d;\n", step.Mask, step.RightShift)
-				}
-			}
+			writeRustArgAssembly(w, arg)
 			switch resultTy {
 
 			case "u32":
@@ -106,166 +266,866 @@ func generateRustRawInstruction(filename string, args map[string]*Argument) erro
 				w.WriteString("        return IntRegister::num(raw as usize);\n")
 			case "FloatRegister":
 				w.WriteString("        return FloatRegister::num(raw as usize);\n")
+			case "Ordering":
+				w.WriteString("        return Ordering::from_bits((raw & 0b10) != 0, (raw & 0b01) != 0);\n")
 			default:
-				fmt.Fprintf(w, "        // ERROR: don't know how to build %s result\n", resultTy)
+				w.Printf("        // ERROR: don't know how to build %s result\n", resultTy)
 			}
 		}
 		w.WriteString("    }\n")
 		w.WriteString("\n")
+
+		// Immediates also get an accessor for the encoded field alone,
+		// before sign extension and scaling, for consumers that re-encode
+		// instructions or compare with tools that report raw fields.
+		if arg.IsImmediate() && arg.EncWidth != 1 {
+			w.Printf("    /// Returns the encoded bits of %s, before sign extension and scaling.\n", arg.Name)
+			w.Printf("    pub %s %s_raw(&self) -> u32 {\n", rustConstFn(), arg.FuncName)
+			writeRustArgAssembly(w, arg)
+			if scale := arg.Scale(); scale != 0 {
+				w.Printf("        return raw >> %d;\n", scale)
+			} else {
+				w.WriteString("        return raw;\n")
+			}
+			w.WriteString("    }\n")
+			w.WriteString("\n")
+		}
 	}
 
 	w.WriteString("}\n")
-	return nil
+
+	writeRustRawInstructionTryFrom(w)
+	writeRustRawInstructionWide(w)
+
+	return w.Err()
 }
 
-func generateRustInstruction(filename string, isa *ISA) error {
-	w, err := os.Create(filename)
-	if err != nil {
-		return err
+// writeRustArgDoc writes the doc comment for the accessor of the given
+// argument, which returns a value of the given Rust type.
+func writeRustArgDoc(w *errWriter, arg *Argument, resultTy string) {
+	width := bits.OnesCount32(uint32(arg.Mask()))
+	unit := "bits"
+	if width == 1 {
+		unit = "bit"
+	}
+	w.Printf("    /// Returns the `%s` operand, encoded as `%s` in %d %s of the instruction.\n", arg.FuncLocalName, arg.Name, width, unit)
+	w.WriteString("    ///\n")
+
+	desc := arg.Type.Description()
+	desc = strings.ToUpper(desc[:1]) + desc[1:]
+	if arg.IsImmediate() {
+		desc += fmt.Sprintf(", %d bits wide", arg.EncWidth)
+		switch scale := arg.Scale(); scale {
+		case 0:
+		case 1:
+			desc += " with the low bit always zero"
+		default:
+			desc += fmt.Sprintf(" with the low %d bits always zero", scale)
+		}
+	}
+	switch resultTy {
+	case "i32":
+		desc += ", sign-extended to `i32`"
+	case "u32":
+		desc += ", zero-extended to `u32`"
+	case "bool":
+		desc = "Flag, true if the bit is set"
 	}
+	w.Printf("    /// %s.\n", desc)
+}
+
+// writeRustArgAssembly writes statements that gather the bits of the given
+// argument from an instruction word into a local variable "raw", in their
+// positions within the argument's value.
+func writeRustArgAssembly(w *errWriter, arg *Argument) {
+	w.WriteString("        let mut raw: u32 = 0;\n")
+	for i, step := range arg.Decoding {
+		maskName := arg.MaskConstName(i, NameSnake)
+		switch {
+		case step.RightShift == 0:
+			w.Printf("        raw |= (self.0 & %s);\n", maskName)
+		case step.RightShift < 0:
+			w.Printf("        raw |= (self.0 & %s) << %d;\n", maskName, -step.RightShift)
+		default:
+			w.Printf("        raw |= (self.0 & %s) >> %d;\n", maskName, step.RightShift)
+		}
+	}
+}
+
+// writeRustRawInstructionTryFrom writes checked conversions to
+// RawInstruction from a standard-length instruction word and from a
+// compressed instruction parcel, which reject values whose length bits
+// disagree with the type they were given as.
+func writeRustRawInstructionTryFrom(w *errWriter) {
+	w.WriteString(`
+/// Describes why an instruction could not be decoded.
+`)
+	w.WriteString(rustDeriveAttr())
+	w.WriteString(`pub enum DecodeError {
+    /// The low bits of the instruction indicate a different length than
+    /// the caller provided.
+    WrongLength,
+}
+
+impl core::convert::TryFrom<u32> for RawInstruction {
+    type Error = DecodeError;
+
+    /// Accepts only a standard-length (32-bit) instruction word.
+    fn try_from(word: u32) -> Result<Self, Self::Error> {
+        if instruction_length(word as u16) != 4 {
+            return Err(DecodeError::WrongLength);
+        }
+        Ok(RawInstruction(word))
+    }
+}
+
+impl core::convert::TryFrom<u16> for RawInstruction {
+    type Error = DecodeError;
+
+    /// Accepts only a compressed (16-bit) instruction parcel.
+    fn try_from(parcel: u16) -> Result<Self, Self::Error> {
+        if instruction_length(parcel) != 2 {
+            return Err(DecodeError::WrongLength);
+        }
+        Ok(RawInstruction(parcel as u32))
+    }
+}
+`)
+}
+
+// writeRustRawInstructionWide writes a type that can represent instructions
+// longer than 32 bits, which RawInstruction cannot. The current spec has no
+// such instructions, but a consumer fetching from memory needs to know how
+// far to advance regardless.
+func writeRustRawInstructionWide(w *errWriter) {
+	w.WriteString(`
+/// Returns the length in bytes of the instruction whose first 16-bit
+/// parcel is given, or zero if the encoding is reserved for instructions
+/// of 192 bits or longer.
+`)
+	w.Printf("pub %s instruction_length(parcel: u16) -> usize {\n", rustConstFn())
+	w.WriteString(`    if parcel & 0b11 != 0b11 {
+        2
+    } else if parcel & 0b11100 != 0b11100 {
+        4
+    } else if parcel & 0b111111 == 0b011111 {
+        6
+    } else if parcel & 0b1111111 == 0b0111111 {
+        8
+    } else {
+        let nnn = ((parcel >> 12) & 0b111) as usize;
+        if nnn == 0b111 { 0 } else { 10 + 2 * nnn }
+    }
+}
+
+/// Represents a raw RISC-V instruction of up to 64 bits that is yet to be
+/// decoded.
+///
+/// Standard-length and compressed instructions can be converted to
+/// RawInstruction using low_word, which is the fast path for decoding.
+`)
+	w.WriteString(rustDeriveAttr())
+	w.WriteString(`pub struct RawInstructionWide {
+    bits: u64,
+    len: usize,
+}
+
+impl RawInstructionWide {
+    /// Reads a single instruction from the start of the given little-endian
+    /// bytes, returning None if there are too few bytes for the instruction
+    /// or if it is longer than 64 bits.
+    pub fn from_bytes(bytes: &[u8]) -> Option<Self> {
+        if bytes.len() < 2 {
+            return None;
+        }
+        let len = instruction_length(u16::from_le_bytes([bytes[0], bytes[1]]));
+        if len == 0 || len > 8 || bytes.len() < len {
+            return None;
+        }
+        let mut bits: u64 = 0;
+        for (i, b) in bytes[..len].iter().enumerate() {
+            bits |= (*b as u64) << (i * 8);
+        }
+        Some(Self { bits, len })
+    }
+
+    /// Returns the length of the instruction in bytes.
+    pub fn len(&self) -> usize {
+        self.len
+    }
+
+    /// Returns the given 16-bit parcel of the instruction, counting from
+    /// the lowest-addressed parcel.
+    pub fn parcel(&self, i: usize) -> u16 {
+        if i * 2 >= self.len {
+            return 0;
+        }
+        (self.bits >> (i * 16)) as u16
+    }
+
+    /// Returns all of the bits of the instruction.
+    pub fn bits(&self) -> u64 {
+        self.bits
+    }
+
+    /// Returns the first 32 bits of the instruction, which is the entire
+    /// instruction for standard-length and compressed instructions.
+    pub fn low_word(&self) -> RawInstruction {
+        RawInstruction(self.bits as u32)
+    }
+}
+`)
+}
+
+// writeRustOrdering writes the type that the combined aq and rl bits of
+// the atomic instructions decode to. Its discriminants are the two bits
+// read as a single number, with aq as the high bit.
+func writeRustOrdering(w *errWriter) error {
+	w.WriteString(`/// The memory ordering constraint of an atomic operation, as given by its
+/// aq (acquire) and rl (release) bits.
+`)
+	w.WriteString(rustDeriveAttr("Clone", "Copy", "Debug", "PartialEq", "Eq"))
+	w.WriteString(`#[repr(u8)]
+pub enum Ordering {
+    Relaxed = 0b00,
+    Release = 0b01,
+    Acquire = 0b10,
+    AcquireRelease = 0b11,
+}
+
+impl Ordering {
+`)
+	w.Printf("    pub %s from_bits(aq: bool, rl: bool) -> Self {\n", rustConstFn())
+	w.WriteString(`        match (aq, rl) {
+            (false, false) => Self::Relaxed,
+            (false, true) => Self::Release,
+            (true, false) => Self::Acquire,
+            (true, true) => Self::AcquireRelease,
+        }
+    }
+
+    /// Returns true if no later memory operation can be observed to take
+    /// place before the atomic operation.
+    pub fn is_acquire(&self) -> bool {
+        matches!(self, Self::Acquire | Self::AcquireRelease)
+    }
+
+    /// Returns true if the atomic operation cannot be observed to take
+    /// place before any earlier memory operation.
+    pub fn is_release(&self) -> bool {
+        matches!(self, Self::Release | Self::AcquireRelease)
+    }
+}
+`)
 
+	return w.Err()
+}
+
+func writeRustInstruction(w *errWriter, isa *ISA, style NameStyle) error {
 	for _, isaSize := range []Size{RV32, RV64} {
 		anyStd := isaSize.Any()
 		w.WriteString("\n")
-		fmt.Fprintf(w, "/// Enumeration of all operations from the RV%d ISA.\n", int(isaSize))
-		fmt.Fprintf(w, "pub enum OperationRV%d {\n", int(isaSize))
+		w.Printf("/// Enumeration of all operations from the RV%d ISA.\n", int(isaSize))
+		w.WriteString(rustDeriveAttr())
+		var discriminants map[*Operation]string
+		if *testDiscriminants {
+			discriminants = rustTestDiscriminants(isa, anyStd)
+			w.WriteString("#[repr(u64)]\n")
+		}
+		w.Printf("pub enum OperationRV%d {\n", int(isaSize))
 
 		for _, ext := range []Extension{ExtI, ExtM, ExtA, ExtS, ExtF, ExtD, ExtQ, ExtC} {
 			extName := isa.ExtensionNames[ext]
-			fmt.Fprintf(w, "\n    // RV%d%c: %s\n\n", int(isaSize), byte(ext), extName)
+			w.Printf("\n    // RV%d%c: %s\n\n", int(isaSize), byte(ext), extName)
 
 			std := MakeStandard(isaSize, ext)
 
-			for _, op := range isa.Ops {
-				if !op.Standards.Has(std) {
-					continue
-				}
-				fmt.Fprintf(w, "    /// %s (RV%d%c)\n", op.FullName, int(isaSize), byte(ext))
-				if len(op.Codec.Operands) == 0 {
-					fmt.Fprintf(w, "    %s,\n", op.TypeName)
-					continue
-				}
-				fmt.Fprintf(w, "    %s {\n", op.TypeName)
-				for _, argName := range op.Codec.Operands {
-					arg := isa.Arguments[argName]
-					rustType := rustTypeForArgType(arg.Type, arg.EncWidth)
-					fmt.Fprintf(w, "        %s: %s,\n", arg.FuncLocalName, rustType)
-				}
-				w.WriteString("    },\n")
-			}
+			writeRustOperationVariants(w, isa, std, style, discriminants)
 		}
 
-		w.WriteString("\n}\n\n")
-
-		opsList := make([]*MajorOpcode, 0, len(isa.MajorOpcodes)+1)
-		for _, op := range isa.MajorOpcodes {
-			opsList = append(opsList, op)
+		w.WriteString("\n    /// An instruction that doesn't encode any of the operations above,\n")
+		w.WriteString("    /// or that violates one of their operand constraints.\n")
+		if *testDiscriminants {
+			// Above the range of both the encoding templates and the
+			// ordinals of operations that share a template.
+			w.WriteString("    Invalid = 0x2_00000000,\n")
+		} else {
+			w.WriteString("    Invalid,\n")
 		}
-		sort.Slice(opsList, func(i, j int) bool {
-			return opsList[i].TypeName < opsList[j].TypeName
-		})
-		opsList = append(opsList, nil)
+		w.WriteString("}\n\n")
+
+		opsList := append(sortedMajorOpcodes(isa.MajorOpcodes), nil)
 
-		fmt.Fprintf(w, "impl OperationRV%d {\n", int(isaSize))
+		w.Printf("impl OperationRV%d {\n", int(isaSize))
+		writeRustWidth(w, isa, anyStd, style)
+		writeRustClass(w, isa, anyStd, style)
+		writeRustValidate(w, isa, anyStd, style)
+		if *testDiscriminants {
+			writeRustEncodingTemplate(w)
+		}
+		if *hints {
+			writeRustIsHint(w, isa, anyStd, style)
+		}
+		if *sharedOperands {
+			writeRustCodecOperands(w, isa, isaSize)
+		}
 		w.WriteString("    fn decode_raw(raw: RawInstruction) -> Self {\n")
 		w.WriteString("        let opcode = raw.opcode();\n")
 		for idx, majorOp := range opsList {
 			switch majorOp {
 			case nil:
-				fmt.Fprintf(w, "        else {\n")
+				w.Printf("        else {\n")
 			default:
 				if idx == 0 {
-					fmt.Fprintf(w, "        if opcode == (Opcode::%s as u8) {\n", majorOp.TypeName)
+					w.Printf("        if opcode == (Opcode::%s as u8) {\n", style.RustIdent(majorOp.Name))
 				} else {
-					fmt.Fprintf(w, "        else if opcode == (Opcode::%s as u8) {\n", majorOp.TypeName)
+					w.Printf("        else if opcode == (Opcode::%s as u8) {\n", style.RustIdent(majorOp.Name))
 				}
 			}
-			i := 0
-			for _, op := range isa.Ops {
-				if op.MajorOpcode != majorOp {
-					continue
-				}
-				if !op.Standards.Has(anyStd) {
-					continue
-				}
-				if i > 0 {
-					w.WriteString("            else if ")
-				} else {
-					w.WriteString("            if ")
-				}
-				i++
-				if majorOp == nil && (op.Mask&0xffff0000) == 0 {
-					// Probably a compressed instruction, so we'll use a more intuitive formatting.
-					fmt.Fprintf(w, "raw.matches(0b%016b, 0b%016b) {\n", op.Mask, op.Test)
-				} else {
-					fmt.Fprintf(w, "raw.matches(0b%032b, 0b%032b) {\n", op.Mask, op.Test)
-				}
-				if len(op.Codec.Operands) == 0 {
-					fmt.Fprintf(w, "                Self::%s\n", op.TypeName)
-				} else {
-					fmt.Fprintf(w, "                Self::%s {\n", op.TypeName)
-					for _, argName := range op.Codec.Operands {
-						arg := isa.Arguments[argName]
-						fmt.Fprintf(w, "                    %s: raw.%s(),\n", arg.FuncLocalName, arg.FuncName)
-					}
-					w.WriteString("                }\n")
-				}
-				w.WriteString("            }\n")
+			w.Indent(3)
+			writeRustMajorOpcodeDecode(w, isa, anyStd, majorOp, style)
+			w.Indent(-3)
+			w.WriteString("        }\n")
+		}
+		w.WriteString("    }\n")
+		writeRustDecodeAt(w)
+		w.WriteString("}\n")
+	}
+	writeRustEncodeError(w)
+
+	return w.Err()
+}
+
+// writeRustOperationVariants writes an enum variant for each of the
+// operations belonging to the given standard, with a field for each of its
+// operands. Variants are given the explicit discriminants in the given map,
+// if any.
+func writeRustOperationVariants(w *errWriter, isa *ISA, std Standard, style NameStyle, discriminants map[*Operation]string) {
+	isaSize := std.Size()
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if !op.Standards.Has(std) {
+			continue
+		}
+		w.Printf("    /// %s (%s)\n", op.DocText(), std)
+		if isa.IsDraft(op) {
+			w.WriteString("    ///\n")
+			w.WriteString("    /// This operation belongs to a draft extension, so its encoding\n")
+			w.WriteString("    /// or behavior may change.\n")
+		}
+		if *encodingDocs {
+			w.WriteString("    ///\n")
+			w.Printf("    /// Encoding: match `0x%08x`, mask `0x%08x`, codec `%s`.\n", uint32(op.Test), uint32(op.Mask), op.Codec.Name)
+		}
+		discriminant := ""
+		if d, ok := discriminants[op]; ok {
+			discriminant = " = " + d
+		}
+		if len(op.Codec.Operands) == 0 {
+			w.Printf("    %s%s,\n", style.RustIdent(op.Name), discriminant)
+			continue
+		}
+		w.Printf("    %s {\n", style.RustIdent(op.Name))
+		for _, argName := range op.Codec.Operands {
+			arg := isa.Argument(argName, isaSize)
+			rustType := rustTypeForArg(arg)
+			w.Printf("        %s: %s,\n", arg.FuncLocalName, rustType)
+		}
+		w.Printf("    }%s,\n", discriminant)
+	}
+}
+
+// rustTestDiscriminants returns the discriminants of the variants of the
+// operations of the given standard when the -test-discriminants option is
+// set: each operation's Test value, so that the enum maps directly back to
+// encoding templates. Operations whose Test value is shared with another
+// operation instead get an ordinal above the range of 32-bit instruction
+// words, and we warn about them.
+func rustTestDiscriminants(isa *ISA, std Standard) map[*Operation]string {
+	byTest := make(map[bits32][]*Operation)
+	var tests []bits32
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if !op.Standards.Has(std) {
+			continue
+		}
+		if _, exists := byTest[op.Test]; !exists {
+			tests = append(tests, op.Test)
+		}
+		byTest[op.Test] = append(byTest[op.Test], op)
+	}
+
+	ret := make(map[*Operation]string)
+	ordinal := 0
+	for _, test := range tests {
+		ops := byTest[test]
+		if len(ops) == 1 {
+			ret[ops[0]] = fmt.Sprintf("0x%08x", uint32(test))
+			continue
+		}
+		names := make([]string, len(ops))
+		for i, op := range ops {
+			names[i] = op.Name
+			ret[op] = fmt.Sprintf("0x1_%08x", ordinal)
+			ordinal++
+		}
+		log.Printf("warning: %s operations %s share encoding 0x%08x, so they have ordinal discriminants", std, strings.Join(names, ", "), uint32(test))
+	}
+	return ret
+}
+
+// writeRustEncodingTemplate writes a method that recovers an operation's
+// encoding template from the discriminants that the -test-discriminants
+// option assigns.
+func writeRustEncodingTemplate(w *errWriter) {
+	w.WriteString(`    /// Returns the fixed bits of the operation's encoding, with all of
+    /// the operand bits zero, or None if the operation shares its fixed
+    /// bits with another operation.
+    pub fn encoding_template(&self) -> Option<u32> {
+        // The enum is repr(u64), so it begins with its discriminant.
+        let discriminant = unsafe { *(self as *const Self as *const u64) };
+        if discriminant <= u32::MAX as u64 {
+            Some(discriminant as u32)
+        } else {
+            None
+        }
+    }
+
+`)
+}
+
+// writeRustWidth writes a method that returns the length of the instruction
+// that an operation belonging to the given standard was decoded from.
+func writeRustWidth(w *errWriter, isa *ISA, std Standard, style NameStyle) {
+	w.WriteString("    /// Returns the length in bytes of the instruction the operation\n")
+	w.WriteString("    /// was decoded from.\n")
+	w.WriteString("    pub fn width(&self) -> usize {\n")
+	w.WriteString("        match self {\n")
+	// Most operations are standard-length, so we'll list only the
+	// others explicitly.
+	byWidth := make(map[int][]string)
+	for _, op := range isa.Ops {
+		if width := op.WidthBytes(); op.Standards.Has(std) && width != 4 {
+			byWidth[width] = append(byWidth[width], fmt.Sprintf("Self::%s { .. }", style.RustIdent(op.Name)))
+		}
+	}
+	var widths []int
+	for width := range byWidth {
+		widths = append(widths, width)
+	}
+	sort.Ints(widths)
+	for _, width := range widths {
+		w.Printf("            %s => %d,\n", strings.Join(byWidth[width], "\n            | "), width)
+	}
+	w.WriteString("            _ => 4,\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+}
+
+// writeRustDecodeAt writes a method that decodes an instruction from a
+// byte buffer, for disassembling a stream of instructions without the
+// caller needing to find the length of each one first.
+func writeRustDecodeAt(w *errWriter) {
+	w.WriteString(`
+    /// Decodes the instruction at the given offset in a buffer of
+    /// little-endian instruction bytes, returning the operation along with
+    /// the number of bytes to advance to reach the next instruction.
+    ///
+    /// The operation is None if the instruction is not valid, or if it is
+    /// longer than any known operation. The length is zero if the buffer
+    /// ends before the end of the instruction, or if the instruction's
+    /// length cannot be determined.
+    pub fn decode_at(bytes: &[u8], offset: usize) -> (Option<Self>, usize) {
+        let bytes = match bytes.get(offset..) {
+            Some(bytes) if bytes.len() >= 2 => bytes,
+            _ => return (None, 0),
+        };
+        let len = instruction_length(u16::from_le_bytes([bytes[0], bytes[1]]));
+        if len == 0 || bytes.len() < len {
+            return (None, 0);
+        }
+        if len > 4 {
+            return (None, len);
+        }
+        let mut word: u32 = 0;
+        for (i, b) in bytes[..len].iter().enumerate() {
+            word |= (*b as u32) << (i * 8);
+        }
+        match Self::decode_raw(RawInstruction(word)) {
+            Self::Invalid => (None, len),
+            op => (Some(op), len),
+        }
+    }
+`)
+}
+
+// writeRustDispatchArray writes an alternative to decode_raw for each
+// base ISA size that selects a per-opcode decoding function by indexing an
+// array with the seven-bit opcode field, rather than by comparing the
+// opcode against each major opcode in turn.
+func writeRustDispatchArray(w *errWriter, isa *ISA, style NameStyle) error {
+	for _, isaSize := range []Size{RV32, RV64} {
+		anyStd := isaSize.Any()
+		target := newRustDecodeTarget(isa, isaSize)
+		typeName := fmt.Sprintf("OperationRV%d", int(isaSize))
+		arrayName := fmt.Sprintf("DISPATCH_RV%d", int(isaSize))
+
+		w.WriteString("\n")
+		w.Printf("impl %s {\n", typeName)
+		w.WriteString("    /// Equivalent to decode_raw, but with the top-level dispatch on\n")
+		w.WriteString("    /// the opcode field performed as a single array lookup.\n")
+		w.Printf("    pub fn decode_dispatch(raw: RawInstruction) -> %s {\n", target.ResultType())
+		w.Printf("        %s[raw.opcode() as usize](raw)\n", arrayName)
+		w.WriteString("    }\n")
+
+		funcNames := make(map[bits8]string)
+		for num := bits8(0); num < 128; num++ {
+			majorOp, ok := isa.MajorOpcodes[num]
+			if !ok {
+				continue
 			}
-			if i == 0 {
-				fmt.Fprintf(w, "            Self::Invalid\n")
-			} else {
-				fmt.Fprintf(w, "            else { Self::Invalid }\n")
+			funcName := "decode_" + majorOp.FuncName
+			funcNames[num] = funcName
+			w.WriteString("\n")
+			w.Printf("    fn %s(raw: RawInstruction) -> %s {\n", funcName, target.ResultType())
+			w.Indent(2)
+			writeRustMajorOpcodeDecode(w, isa, anyStd, majorOp, style)
+			w.Indent(-2)
+			w.WriteString("    }\n")
+		}
+		w.WriteString("\n")
+		w.Printf("    fn decode_other(raw: RawInstruction) -> %s {\n", target.ResultType())
+		w.Indent(2)
+		writeRustMajorOpcodeDecode(w, isa, anyStd, nil, style)
+		w.Indent(-2)
+		w.WriteString("    }\n")
+		w.WriteString("}\n\n")
+
+		// Compressed instructions and instructions longer than 32 bits
+		// are distinguished by the low-order bits of the opcode field, so
+		// all of the array entries without a major opcode must fall back
+		// to decode_other.
+		resultType := strings.Replace(target.ResultType(), "Self", typeName, 1)
+		w.Printf("static %s: [fn(RawInstruction) -> %s; 128] = [\n", arrayName, resultType)
+		for num := 0; num < 128; num++ {
+			funcName, ok := funcNames[bits8(num)]
+			if !ok {
+				funcName = "decode_other"
 			}
-			w.WriteString("        }\n")
+			w.Printf("    %s::%s, // 0b%07b\n", typeName, funcName, num)
+		}
+		w.WriteString("];\n")
+	}
+
+	// We can't assume that the consuming crate has access to a
+	// benchmarking framework, so this is just an ignored test that
+	// reports its own timings when run with --ignored --nocapture.
+	w.WriteString("\n")
+	w.WriteString("#[cfg(test)]\n")
+	w.WriteString("mod dispatch_bench {\n")
+	w.WriteString("    use super::*;\n")
+	w.WriteString("    use std::time::Instant;\n\n")
+	w.WriteString("    #[test]\n")
+	w.WriteString("    #[ignore]\n")
+	w.WriteString("    fn compare_decode_raw_and_decode_dispatch() {\n")
+	w.WriteString("        const ROUNDS: u32 = 1_000_000;\n")
+	w.WriteString("        let start = Instant::now();\n")
+	w.WriteString("        for i in 0..ROUNDS {\n")
+	w.WriteString("            std::hint::black_box(OperationRV64::decode_raw(RawInstruction(i.wrapping_mul(2654435761))));\n")
+	w.WriteString("        }\n")
+	w.WriteString("        let match_time = start.elapsed();\n")
+	w.WriteString("        let start = Instant::now();\n")
+	w.WriteString("        for i in 0..ROUNDS {\n")
+	w.WriteString("            std::hint::black_box(OperationRV64::decode_dispatch(RawInstruction(i.wrapping_mul(2654435761))));\n")
+	w.WriteString("        }\n")
+	w.WriteString("        let dispatch_time = start.elapsed();\n")
+	w.WriteString("        println!(\"decode_raw: {:?}, decode_dispatch: {:?}\", match_time, dispatch_time);\n")
+	w.WriteString("    }\n")
+	w.WriteString("}\n")
+
+	return w.Err()
+}
+
+// writeRustCompressedDecode writes a decoder for each base ISA size that
+// handles only compressed instructions, first selecting by the quadrant in
+// bits 1:0 and then by the funct3 field in bits 15:13 as a hardware decoder
+// would, before testing the remaining bits of each candidate operation.
+func writeRustCompressedDecode(w *errWriter, isa *ISA, style NameStyle) error {
+	const quadrantMask = bits32(0b11)
+	const funct3Mask = bits32(0b111 << 13)
+
+	for _, isaSize := range []Size{RV32, RV64} {
+		anyStd := isaSize.Any()
+		target := newRustDecodeTarget(isa, isaSize)
+
+		type key struct {
+			Quadrant, Funct3 bits32
 		}
+		groups := make(map[key][]*Operation)
+		var keys []key
+		var others []*Operation
+		for i := range isa.Ops {
+			op := &isa.Ops[i]
+			if op.Parcels() != 1 || !op.Standards.Has(anyStd) {
+				continue
+			}
+			if op.Mask&quadrantMask != quadrantMask || op.Mask&funct3Mask != funct3Mask {
+				others = append(others, op)
+				continue
+			}
+			k := key{op.Test & quadrantMask, (op.Test & funct3Mask) >> 13}
+			if _, exists := groups[k]; !exists {
+				keys = append(keys, k)
+			}
+			groups[k] = append(groups[k], op)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].Quadrant != keys[j].Quadrant {
+				return keys[i].Quadrant < keys[j].Quadrant
+			}
+			return keys[i].Funct3 < keys[j].Funct3
+		})
+
+		w.WriteString("\n")
+		w.Printf("impl OperationRV%d {\n", int(isaSize))
+		w.Printf("    /// Decodes a 16-bit compressed instruction, returning %s if the\n", target.Invalid())
+		w.WriteString("    /// parcel is not a valid compressed instruction.\n")
+		w.Printf("    pub fn decode_compressed(parcel: u16) -> %s {\n", target.ResultType())
+		w.WriteString("        let raw = RawInstruction(parcel as u32);\n")
+		w.WriteString("        match (parcel & 0b11, (parcel >> 13) & 0b111) {\n")
+		for _, k := range keys {
+			ops := groups[k]
+			sort.SliceStable(ops, func(i, j int) bool {
+				return ops[i].Specificity() > ops[j].Specificity()
+			})
+			w.Printf("            (0b%02b, 0b%03b) => {\n", uint32(k.Quadrant), uint32(k.Funct3))
+			w.Indent(4)
+			writeRustOpsDecode(w, isa, isaSize, ops, style)
+			w.Indent(-4)
+			w.WriteString("            }\n")
+		}
+		w.WriteString("            _ => {\n")
+		w.Indent(4)
+		writeRustOpsDecode(w, isa, isaSize, others, style)
+		w.Indent(-4)
+		w.WriteString("            }\n")
+		w.WriteString("        }\n")
 		w.WriteString("    }\n")
 		w.WriteString("}\n")
 	}
 
-	return nil
+	return w.Err()
 }
 
-func generateRustExec(filename string, isa *ISA, isaSize Size) error {
-	w, err := os.Create(filename)
-	if err != nil {
-		return err
+// writeRustIsHint writes a method that reports whether the operation was
+// decoded from a HINT encoding. This doesn't affect the decoding itself:
+// HINTs decode as the operation whose encoding space they occupy.
+func writeRustIsHint(w *errWriter, isa *ISA, anyStd Standard, style NameStyle) {
+	w.WriteString("    /// Returns true if the operation was decoded from an encoding that\n")
+	w.WriteString("    /// is reserved for HINTs.\n")
+	w.WriteString("    pub fn is_hint(&self) -> bool {\n")
+	w.WriteString("        match self {\n")
+	for _, op := range isa.Ops {
+		if !op.Standards.Has(anyStd) {
+			continue
+		}
+		for _, conds := range op.Hints {
+			var names, tests []string
+			for _, cond := range conds {
+				name := cond.Arg.FuncLocalName
+				names = append(names, name)
+				tests = append(tests, rustConditionExpr(cond, name, true))
+			}
+			w.Printf("            Self::%s { %s, .. } if %s => true,\n", style.RustIdent(op.Name), strings.Join(names, ", "), strings.Join(tests, " && "))
+		}
+	}
+	w.WriteString("            _ => false,\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+}
+
+// writeRustMajorOpcodeDecode writes a Rust expression that decodes a raw
+// instruction known to belong to the given major opcode, or to none of the
+// major opcodes if majorOp is nil.
+func writeRustMajorOpcodeDecode(w *errWriter, isa *ISA, anyStd Standard, majorOp *MajorOpcode, style NameStyle) {
+	var ops []*Operation
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if op.MajorOpcode != majorOp {
+			continue
+		}
+		if !op.Standards.Has(anyStd) {
+			continue
+		}
+		ops = append(ops, op)
 	}
+	writeRustOpsDecode(w, isa, anyStd.Size(), ops, style)
+}
+
+// writeRustOpsDecode writes a Rust expression that decodes a raw
+// instruction as the first of the given operations that it matches, or as
+// an invalid instruction if it matches none of them, extracting the
+// operands as encoded for the given base ISA size.
+func writeRustOpsDecode(w *errWriter, isa *ISA, size Size, ops []*Operation, style NameStyle) {
+	target := newRustDecodeTarget(isa, size)
+	i := 0
+	for _, op := range ops {
+		if !target.Includes(op) {
+			continue
+		}
+		if i > 0 {
+			w.WriteString("else if ")
+		} else {
+			w.WriteString("if ")
+		}
+		i++
+		if op.Parcels() == 1 {
+			// A compressed instruction, so we'll use a more intuitive formatting.
+			w.Printf("raw.matches(0b%016b, 0b%016b) {\n", op.Mask, op.Test)
+		} else {
+			w.Printf("raw.matches(0b%032b, 0b%032b) {\n", op.Mask, op.Test)
+		}
+		w.Indent(1)
+		// Encodings that violate the operation's constraints are
+		// reserved, so they must decode as invalid rather than falling
+		// through to some less specific operation.
+		if len(op.Constraints) != 0 {
+			tests := make([]string, len(op.Constraints))
+			for i, cond := range op.Constraints {
+				tests[i] = rustConditionExpr(cond, "raw."+cond.Arg.ForSize(size).FuncName+"()", false)
+			}
+			w.Printf("if %s {\n", strings.Join(tests, " && "))
+			w.Indent(1)
+		}
+		open, close := target.Value(op, style)
+		switch {
+		case len(op.Codec.Operands) == 0:
+			w.Printf("%s%s\n", open, close)
+		case *sharedOperands && !target.Split() && rustSharesOperands(isa, op.Codec, size):
+			names := make([]string, len(op.Codec.Operands))
+			for i, argName := range op.Codec.Operands {
+				names[i] = isa.Argument(argName, size).FuncLocalName
+			}
+			fields := strings.Join(names, ", ")
+			w.Printf("let %s = Self::operands_%s(&raw);\n", rustTuple(names), op.Codec.FuncName)
+			w.Printf("%s { %s }%s\n", open, fields, close)
+		default:
+			w.Printf("%s {\n", open)
+			for _, argName := range op.Codec.Operands {
+				arg := isa.Argument(argName, size)
+				w.Printf("    %s: raw.%s(),\n", arg.FuncLocalName, arg.FuncName)
+			}
+			w.Printf("}%s\n", close)
+		}
+		if len(op.Constraints) != 0 {
+			w.Indent(-1)
+			w.WriteString("} else {\n")
+			w.Printf("    %s\n", target.Invalid())
+			w.WriteString("}\n")
+		}
+		w.Indent(-1)
+		w.WriteString("}\n")
+	}
+	if i == 0 {
+		w.Printf("%s\n", target.Invalid())
+	} else {
+		w.Printf("else { %s }\n", target.Invalid())
+	}
+}
+
+// writeRustCodecOperands writes a function for each codec whose operands
+// the decoders for the given base ISA size extract by sharing, as decided
+// by rustSharesOperands, when the -shared-operands option is set.
+func writeRustCodecOperands(w *errWriter, isa *ISA, size Size) {
+	for _, name := range sortedCodecNames(isa.Codecs) {
+		codec := isa.Codecs[name]
+		if !rustSharesOperands(isa, codec, size) {
+			continue
+		}
+		var types, values []string
+		for _, argName := range codec.Operands {
+			arg := isa.Argument(argName, size)
+			types = append(types, rustTypeForArg(arg))
+			values = append(values, fmt.Sprintf("raw.%s()", arg.FuncName))
+		}
+		w.Printf("    /// Extracts the operands of the %s codec.\n", codec.Name)
+		w.Printf("    fn operands_%s(raw: &RawInstruction) -> %s {\n", codec.FuncName, rustTuple(types))
+		w.Printf("        %s\n", rustTuple(values))
+		w.WriteString("    }\n\n")
+	}
+}
 
+// rustSharesOperands returns true if the decoders for the given base ISA
+// size should extract the operands of the given codec using a shared
+// function. Sharing only makes the code smaller for a codec with at least
+// two operands that at least two operations use, since otherwise the
+// function and the tuple that it returns cost more than they save.
+func rustSharesOperands(isa *ISA, codec *Codec, size Size) bool {
+	if len(codec.Operands) < 2 {
+		return false
+	}
+	anyStd := size.Any()
+	uses := 0
+	for i := range isa.Ops {
+		if op := &isa.Ops[i]; op.Codec == codec && op.Standards.Has(anyStd) {
+			uses++
+		}
+	}
+	return uses >= 2
+}
+
+// rustTuple returns a Rust tuple of the given elements, which can be
+// types, expressions, or patterns.
+func rustTuple(elems []string) string {
+	if len(elems) == 1 {
+		return "(" + elems[0] + ",)"
+	}
+	return "(" + strings.Join(elems, ", ") + ")"
+}
+
+func writeRustExec(w *errWriter, isa *ISA, isaSize Size, style NameStyle) error {
 	w.WriteString("\n")
-	fmt.Fprintf(w, "// The main instruction dispatch logic for RV%d: selects a suitable\n", int(isaSize))
-	fmt.Fprintf(w, "// implementation function based on the specific operation in the instruction.\n")
-	fmt.Fprintf(w, "fn dispatch_instruction<Mem: Bus<u%d>>(\n", int(isaSize))
-	fmt.Fprintf(w, "    inst: Instruction<Op, u%d>,\n", int(isaSize))
-	fmt.Fprintf(w, "    hart: &mut impl Hart<u%d, u%d, f64, Mem>,\n", int(isaSize), int(isaSize))
-	fmt.Fprintf(w, ") {\n")
-	fmt.Fprintf(w, "    match inst.op {\n")
+	w.Printf("// The main instruction dispatch logic for RV%d: selects a suitable\n", int(isaSize))
+	w.Printf("// implementation function based on the specific operation in the instruction.\n")
+	w.Printf("fn dispatch_instruction<Mem: Bus<u%d>>(\n", int(isaSize))
+	w.Printf("    inst: Instruction<Op, u%d>,\n", int(isaSize))
+	w.Printf("    hart: &mut impl Hart<u%d, u%d, f64, Mem>,\n", int(isaSize), int(isaSize))
+	w.Printf(") {\n")
+	w.Printf("    match inst.op {\n")
 
 	std := isaSize.Any().Base()
+	target := newRustDecodeTarget(isa, isaSize)
 	for _, op := range isa.Ops {
-		if !op.Standards.Has(std) {
+		if !op.Standards.Has(std) || !target.Includes(&op) {
 			continue
 		}
+		open, close := target.Variant("Op", &op, style)
 		if len(op.Codec.Operands) == 0 {
-			fmt.Fprintf(w, "        Op::%s => exec_%s(hart, inst", op.TypeName, op.FuncName)
+			w.Printf("        %s%s => exec_%s(hart, inst", open, close, op.FuncName)
 		} else {
-			fmt.Fprintf(w, "        Op::%s { ", op.TypeName)
+			w.Printf("        %s { ", open)
 			for i, name := range op.Codec.Operands {
 				if i > 0 {
 					w.WriteString(", ")
 				}
-				arg := isa.Arguments[name]
+				arg := isa.Argument(name, isaSize)
 				w.WriteString(arg.FuncLocalName)
 			}
-			fmt.Fprintf(w, " } => exec_%s(hart, inst", op.FuncName)
+			w.Printf(" }%s => exec_%s(hart, inst", close, op.FuncName)
 		}
 		for _, argName := range op.Codec.Operands {
-			arg := isa.Arguments[argName]
+			arg := isa.Argument(argName, isaSize)
 			w.WriteString(", ")
 			w.WriteString(arg.FuncLocalName)
 		}
 		w.WriteString("),\n")
 	}
+	if target.Split() {
+		// The split enums have no Invalid variant, so this arm is
+		// reachable only for an operation that belongs to more than one
+		// extension and so is matched above under just one of them.
+		w.WriteString("        #[allow(unreachable_patterns)]\n")
+	}
 	w.WriteString("        _ => hart.exception(ExceptionCause::IllegalInstruction),\n")
 	w.WriteString("    }\n")
 	w.WriteString("}\n\n")
@@ -275,38 +1135,506 @@ func generateRustExec(filename string, isa *ISA, isaSize Size) error {
 			continue
 		}
 		w.WriteString("\n")
-		fmt.Fprintf(w, "// %s: %s.\n", op.FullName, op.Description)
-		fmt.Fprintf(w, "//\n")
-		fmt.Fprintf(w, "// > %s\n", op.Pseudocode)
-		fmt.Fprintf(w, "fn exec_%s<Mem: Bus<u%d>>(\n", op.FuncName, int(isaSize))
-		fmt.Fprintf(w, "    hart: &mut impl Hart<u%d, u%d, f64, Mem>,\n", int(isaSize), int(isaSize))
-		fmt.Fprintf(w, "    _inst: Instruction<Op, u%d>,\n", int(isaSize))
+		w.Printf("// %s\n", op.DocText())
+		if op.Pseudocode != "" {
+			w.Printf("//\n")
+			w.Printf("// > %s\n", op.Pseudocode)
+		}
+		w.Printf("fn exec_%s<Mem: Bus<u%d>>(\n", op.FuncName, int(isaSize))
+		w.Printf("    hart: &mut impl Hart<u%d, u%d, f64, Mem>,\n", int(isaSize), int(isaSize))
+		w.Printf("    _inst: Instruction<Op, u%d>,\n", int(isaSize))
 		for _, name := range op.Codec.Operands {
-			arg := isa.Arguments[name]
-			resultTy := rustTypeForArgType(arg.Type, arg.EncWidth)
-			fmt.Fprintf(w, "    %s: %s,\n", arg.FuncLocalName, resultTy)
+			arg := isa.Argument(name, isaSize)
+			resultTy := rustTypeForArg(arg)
+			w.Printf("    %s: %s,\n", arg.FuncLocalName, resultTy)
+		}
+		w.Printf(") {\n")
+		w.Printf("    // TODO: Implement\n")
+		w.Printf("    hart.exception(ExceptionCause::IllegalInstruction);\n")
+		w.Printf("}\n")
+	}
+
+	return w.Err()
+}
+
+func writeRustCSRs(w *errWriter, csrs []*CSR, style NameStyle) error {
+	// Some CSR addresses were reassigned in later versions of the
+	// privileged specification, so we'll include only the current
+	// definitions to keep the numbering unique.
+	current := make([]*CSR, 0, len(csrs))
+	for _, csr := range csrs {
+		if csr.Deprecated {
+			continue
+		}
+		current = append(current, csr)
+	}
+
+	w.WriteString("/// Enumeration of the known control and status registers.\n")
+	w.WriteString(rustDeriveAttr())
+	w.WriteString("#[repr(u16)]\n")
+	w.WriteString("pub enum Csr {\n")
+	for _, csr := range current {
+		w.Printf("    /// %s\n", csr.Description)
+		w.Printf("    %s = 0x%03x,\n", style.RustIdent(csr.Name), uint16(csr.Num))
+	}
+	w.WriteString("}\n\n")
+
+	w.WriteString("impl Csr {\n")
+	w.WriteString("    pub fn from_u16(num: u16) -> Option<Self> {\n")
+	w.WriteString("        match num {\n")
+	for _, csr := range current {
+		w.Printf("            0x%03x => Some(Self::%s),\n", uint16(csr.Num), style.RustIdent(csr.Name))
+	}
+	w.WriteString("            _ => None,\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    pub fn name(&self) -> &'static str {\n")
+	w.WriteString("        match self {\n")
+	for _, csr := range current {
+		w.Printf("            Self::%s => %q,\n", style.RustIdent(csr.Name), csr.Name)
+	}
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    pub fn is_read_only(&self) -> bool {\n")
+	w.WriteString("        match self {\n")
+	for _, csr := range current {
+		if !csr.ReadOnly {
+			continue
+		}
+		w.Printf("            Self::%s => true,\n", style.RustIdent(csr.Name))
+	}
+	w.WriteString("            _ => false,\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n")
+	w.WriteString("}\n")
+
+	return w.Err()
+}
+
+func writeRustOperationKind(w *errWriter, isa *ISA, style NameStyle) error {
+	// The same operation name can appear more than once in isa.Ops when
+	// its encoding differs between base ISA sizes, but the kind is just
+	// the name so we need only one variant for each.
+	var ops []*Operation
+	seen := make(map[string]struct{})
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if _, ok := seen[op.Name]; ok {
+			continue
+		}
+		seen[op.Name] = struct{}{}
+		ops = append(ops, op)
+	}
+
+	w.WriteString("/// Enumeration of all operations across all base ISA sizes, without\n")
+	w.WriteString("/// any operands.\n")
+	w.WriteString(rustDeriveAttr("Clone", "Copy"))
+	w.WriteString("pub enum OperationKind {\n")
+	for _, op := range ops {
+		w.Printf("    /// %s\n", op.DocText())
+		w.Printf("    %s,\n", style.RustIdent(op.Name))
+	}
+	w.WriteString("}\n\n")
+
+	w.WriteString("impl OperationKind {\n")
+	w.WriteString("    /// All of the operations, in the same order as the enum variants.\n")
+	w.WriteString("    pub const ALL: &'static [OperationKind] = &[\n")
+	for _, op := range ops {
+		w.Printf("        Self::%s,\n", style.RustIdent(op.Name))
+	}
+	w.WriteString("    ];\n\n")
+
+	w.WriteString("    /// Returns an iterator over all of the operations.\n")
+	w.WriteString("    pub fn all() -> impl Iterator<Item = OperationKind> {\n")
+	w.WriteString("        Self::ALL.iter().copied()\n")
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    /// Returns the assembly mnemonic for the operation.\n")
+	w.WriteString("    pub fn name(&self) -> &'static str {\n")
+	w.WriteString("        match self {\n")
+	for _, op := range ops {
+		w.Printf("            Self::%s => %q,\n", style.RustIdent(op.Name), renderMnemonic(op.Name, mnemonicStyle))
+	}
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    /// Returns the letter of the standard extension that defines the\n")
+	w.WriteString("    /// operation, such as 'I' for the base integer instructions.\n")
+	w.WriteString("    pub fn extension(&self) -> char {\n")
+	w.WriteString("        match self {\n")
+	for _, op := range ops {
+		ext := '?'
+		if exts := op.Standards.Extensions(); len(exts) != 0 {
+			ext = rune(exts[0])
 		}
-		fmt.Fprintf(w, ") {\n")
-		fmt.Fprintf(w, "    // TODO: Implement\n")
-		fmt.Fprintf(w, "    hart.exception(ExceptionCause::IllegalInstruction);\n")
-		fmt.Fprintf(w, "}\n")
+		w.Printf("            Self::%s => '%c',\n", style.RustIdent(op.Name), ext)
+	}
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    /// Returns a broad category for the operation, such as \"load\" or\n")
+	w.WriteString("    /// \"branch\", for grouping operations.\n")
+	w.WriteString("    pub fn category(&self) -> &'static str {\n")
+	w.WriteString("        match self {\n")
+	for _, op := range ops {
+		w.Printf("            Self::%s => %q,\n", style.RustIdent(op.Name), op.Category(isa))
+	}
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    /// Returns the category of the operation as an OpClass, for use with\n")
+	w.WriteString("    /// matches! and exhaustive matching.\n")
+	w.WriteString("    pub fn class(&self) -> OpClass {\n")
+	w.WriteString("        match self {\n")
+	for _, op := range ops {
+		w.Printf("            Self::%s => OpClass::%s,\n", style.RustIdent(op.Name), rustOpClass(op.Category(isa)))
+	}
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	for _, attr := range isa.AttrNames() {
+		var variants []string
+		for _, op := range ops {
+			if op.HasAttr(attr) {
+				variants = append(variants, "Self::"+style.RustIdent(op.Name))
+			}
+		}
+		w.Printf("    /// Returns true if the operation has the %s attribute.\n", attr)
+		w.Printf("    pub fn is_%s(&self) -> bool {\n", attr)
+		w.Printf("        matches!(\n")
+		w.Printf("            self,\n")
+		w.Printf("            %s\n", strings.Join(variants, "\n                | "))
+		w.Printf("        )\n")
+		w.WriteString("    }\n\n")
+	}
+
+	w.WriteString("    /// Returns the names of the operand fields of the operation in the\n")
+	w.WriteString("    /// order they are written in assembly language, which is the order\n")
+	w.WriteString("    /// an assembler should expect to find them after the mnemonic.\n")
+	w.WriteString("    pub fn operand_names(&self) -> &'static [&'static str] {\n")
+	w.WriteString("        match self {\n")
+	for _, op := range ops {
+		names := make([]string, len(op.Codec.Operands))
+		for i, argName := range op.Codec.Operands {
+			names[i] = fmt.Sprintf("%q", isa.Arguments[argName].FuncLocalName)
+		}
+		w.Printf("            Self::%s => &[%s],\n", style.RustIdent(op.Name), strings.Join(names, ", "))
+	}
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    /// Returns the integer registers that the operation always uses without\n")
+	w.WriteString("    /// encoding them in an operand, as pairs of the role the register plays\n")
+	w.WriteString("    /// in the equivalent uncompressed operation (\"rd\", \"rs1\", or \"rs2\")\n")
+	w.WriteString("    /// and the register number.\n")
+	w.WriteString("    pub fn implicit_operands(&self) -> &'static [(&'static str, u8)] {\n")
+	w.WriteString("        match self {\n")
+	for _, op := range ops {
+		if len(op.Implicit) == 0 {
+			continue
+		}
+		pairs := make([]string, len(op.Implicit))
+		for i, imp := range op.Implicit {
+			pairs[i] = fmt.Sprintf("(%q, %d)", imp.Role, imp.Reg)
+		}
+		w.Printf("            Self::%s => &[%s],\n", style.RustIdent(op.Name), strings.Join(pairs, ", "))
+	}
+	w.WriteString("            _ => &[],\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    /// Like the FromStr implementation, but ignores the case of the given\n")
+	w.WriteString("    /// mnemonic.\n")
+	w.WriteString("    pub fn parse_ignore_case(s: &str) -> Option<Self> {\n")
+	w.WriteString("        s.to_ascii_lowercase().parse().ok()\n")
+	w.WriteString("    }\n")
+	w.WriteString("}\n\n")
+
+	w.WriteString("impl std::str::FromStr for OperationKind {\n")
+	w.WriteString("    type Err = ();\n\n")
+	w.WriteString("    fn from_str(s: &str) -> Result<Self, Self::Err> {\n")
+	w.WriteString("        match s {\n")
+	for _, op := range ops {
+		w.Printf("            %q => Ok(Self::%s),\n", renderMnemonic(op.Name, mnemonicStyle), style.RustIdent(op.Name))
 	}
+	w.WriteString("            _ => Err(()),\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n")
+	w.WriteString("}\n\n")
 
-	return nil
+	w.WriteString("/// A broad classification of operations, derived from their major\n")
+	w.WriteString("/// opcodes. Compressed operations take the class of the operation they\n")
+	w.WriteString("/// expand to.\n")
+	w.WriteString(rustDeriveAttr("Clone", "Copy", "Debug", "PartialEq", "Eq"))
+	w.WriteString("pub enum OpClass {\n")
+	for _, category := range categories {
+		w.Printf("    %s,\n", rustOpClass(category))
+	}
+	w.WriteString("}\n")
+
+	return w.Err()
+}
+
+// rustOpClass returns the name of the OpClass variant for the given
+// operation category.
+func rustOpClass(category string) string {
+	return makeIdentTitle(category)
 }
 
-func rustTypeForArgType(ty ArgType, encWidth int) string {
-	switch ty {
-	case ArgIntReg, ArgCompressedReg:
+// writeRustClass writes a method that returns the OpClass of an operation
+// belonging to the given standard, grouping the variants of each class
+// into a single match arm.
+func writeRustClass(w *errWriter, isa *ISA, std Standard, style NameStyle) {
+	byClass := make(map[string][]string)
+	for i := range isa.Ops {
+		if op := &isa.Ops[i]; op.Standards.Has(std) {
+			category := op.Category(isa)
+			byClass[category] = append(byClass[category], fmt.Sprintf("Self::%s { .. }", style.RustIdent(op.Name)))
+		}
+	}
+	w.WriteString("    /// Returns the broad class of the operation.\n")
+	w.WriteString("    pub fn class(&self) -> OpClass {\n")
+	w.WriteString("        match self {\n")
+	for _, category := range categories {
+		if variants := byClass[category]; len(variants) != 0 {
+			w.Printf("            %s => OpClass::%s,\n", strings.Join(variants, "\n            | "), rustOpClass(category))
+		}
+	}
+	// An invalid operation has no class of its own, so it falls into the
+	// catch-all class, like the fallback arms of width and validate.
+	w.Printf("            _ => OpClass::%s,\n", rustOpClass(categoryOther))
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+}
+
+// writeRustValidate writes a method that checks that the operand values of
+// an operation belonging to the given standard fit the fields that encode
+// them, so that an encoder can reject them rather than silently discarding
+// bits. It also checks the operation's operand constraints, since values
+// that violate them would produce a reserved encoding.
+func writeRustValidate(w *errWriter, isa *ISA, std Standard, style NameStyle) {
+	w.WriteString("    /// Checks that all of the operation's operands can be encoded\n")
+	w.WriteString("    /// exactly, returning an error naming the first that cannot.\n")
+	w.WriteString("    pub fn validate(&self) -> Result<(), EncodeError> {\n")
+	w.WriteString("        match self {\n")
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if !op.Standards.Has(std) {
+			continue
+		}
+		var names, checks []string
+		for _, argName := range op.Codec.Operands {
+			arg := isa.Argument(argName, std.Size())
+			if !arg.IsImmediate() || arg.EncWidth == 1 {
+				continue
+			}
+			min, max := int64(0), int64(1)<<uint(arg.EncWidth)-1
+			if arg.IsSigned() {
+				min, max = -(int64(1) << uint(arg.EncWidth-1)), int64(1)<<uint(arg.EncWidth-1)-1
+			}
+			names = append(names, arg.FuncLocalName)
+			checks = append(checks, fmt.Sprintf("check_operand(%q, *%s as i64, %d, %d, %d)?;", arg.FuncLocalName, arg.FuncLocalName, min, max, int64(1)<<uint(arg.Scale())))
+		}
+		for _, cond := range op.Constraints {
+			name := cond.Arg.FuncLocalName
+			names = append(names, name)
+			violated := cond
+			violated.NotEqual = !cond.NotEqual
+			checks = append(checks, fmt.Sprintf("if %s {\n    return Err(EncodeError { operand: %q, constraint: OperandConstraint::Reserved });\n}", rustConditionExpr(violated, name, true), name))
+		}
+		if len(checks) == 0 {
+			continue
+		}
+		w.Printf("            Self::%s { %s, .. } => {\n", style.RustIdent(op.Name), strings.Join(sortedUnique(names), ", "))
+		for _, check := range checks {
+			for _, line := range strings.Split(check, "\n") {
+				w.Printf("                %s\n", line)
+			}
+		}
+		w.WriteString("            }\n")
+	}
+	w.WriteString("            _ => {}\n")
+	w.WriteString("        }\n")
+	w.WriteString("        Ok(())\n")
+	w.WriteString("    }\n\n")
+}
+
+// writeRustEncodeError writes the error type that the validate methods
+// return, along with the helper that they use to check each immediate.
+func writeRustEncodeError(w *errWriter) {
+	// EncodeError names its operand with a static string, which serde
+	// can't deserialize, so it doesn't take the -serde derives.
+	w.WriteString(`
+/// Describes why an operation cannot be encoded.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct EncodeError {
+    /// The name of the operand whose value cannot be encoded.
+    pub operand: &'static str,
+    /// The constraint that the operand's value violates.
+    pub constraint: OperandConstraint,
+}
+
+/// A constraint that an operand's value must satisfy to be encoded.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum OperandConstraint {
+    /// The value must be within the given inclusive range, which is
+    /// limited by the width and signedness of the field that encodes it.
+    Range { min: i64, max: i64 },
+    /// The value must be a multiple of the given power of two, because
+    /// the field that encodes it omits the low bits.
+    Alignment(i64),
+    /// The value would produce an encoding that is reserved.
+    Reserved,
+}
+
+fn check_operand(operand: &'static str, value: i64, min: i64, max: i64, align: i64) -> Result<(), EncodeError> {
+    if value < min || value > max {
+        return Err(EncodeError { operand, constraint: OperandConstraint::Range { min, max } });
+    }
+    if value % align != 0 {
+        return Err(EncodeError { operand, constraint: OperandConstraint::Alignment(align) });
+    }
+    Ok(())
+}
+`)
+}
+
+func writeRustRegisterNames(w *errWriter, isa *ISA, abi bool) error {
+	types := []struct {
+		ty       ArgType
+		typeName string
+		constant string
+	}{
+		{ArgIntReg, "IntRegister", "INT_REGISTER_NAMES"},
+		{ArgFloatReg, "FloatRegister", "FLOAT_REGISTER_NAMES"},
+	}
+	for _, t := range types {
+		if abi {
+			w.Printf("/// ABI names of the registers represented by %s.\n", t.typeName)
+		} else {
+			w.Printf("/// Architectural names of the registers represented by %s.\n", t.typeName)
+		}
+		w.Printf("pub const %s: [&str; 32] = [\n", t.constant)
+		for num := 0; num < 32; num++ {
+			w.Printf("    %q,\n", isa.RegisterName(t.ty, num, abi))
+		}
+		w.WriteString("];\n\n")
+
+		// The register types themselves are defined by the consuming crate,
+		// which must give them an index method returning the register
+		// number.
+		w.Printf("impl std::fmt::Display for %s {\n", t.typeName)
+		w.WriteString("    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {\n")
+		w.Printf("        f.write_str(%s[self.index()])\n", t.constant)
+		w.WriteString("    }\n")
+		w.WriteString("}\n\n")
+	}
+
+	w.WriteString("/// The role of an integer register in the standard calling convention.\n")
+	w.WriteString(rustDeriveAttr("Clone", "Copy", "Debug", "PartialEq", "Eq"))
+	w.WriteString("pub enum RegRole {\n")
+	for _, name := range regRoleNames {
+		w.Printf("    %s,\n", name)
+	}
+	w.WriteString("}\n\n")
+	w.WriteString("impl IntRegister {\n")
+	w.WriteString("    /// Returns the role of the register in the standard calling convention.\n")
+	w.WriteString("    pub fn role(&self) -> RegRole {\n")
+	w.WriteString("        match self.index() {\n")
+	for num := 0; num < 32; num++ {
+		w.Printf("            %d => RegRole::%s,\n", num, isa.IntRegisterRole(num))
+	}
+	w.WriteString("            _ => unreachable!(),\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n")
+	w.WriteString("}\n")
+
+	return w.Err()
+}
+
+// rustDeriveAttr returns the derive attribute for the generated Rust types,
+// as configured by the -derives and -serde options, including its trailing
+// newline. Any required traits are derived regardless of those options.
+// It returns an empty string if there is nothing to derive.
+func rustDeriveAttr(required ...string) string {
+	all := append(required, strings.Split(*rustDerives, ",")...)
+	if *serde {
+		all = append(all, "Serialize", "Deserialize")
+	}
+	var traits []string
+	seen := make(map[string]struct{})
+	for _, raw := range all {
+		trait := strings.TrimSpace(raw)
+		if _, ok := seen[trait]; ok || trait == "" {
+			continue
+		}
+		seen[trait] = struct{}{}
+		traits = append(traits, trait)
+	}
+	if len(traits) == 0 {
+		return ""
+	}
+	return "#[derive(" + strings.Join(traits, ", ") + ")]\n"
+}
+
+// rustConditionExpr returns a Rust boolean expression testing the given
+// condition against the operand value produced by expr. If ref is set then
+// expr is a reference to the value, as when bound by matching on &self.
+func rustConditionExpr(cond OperandCondition, expr string, ref bool) string {
+	cmp := "=="
+	if cond.NotEqual {
+		cmp = "!="
+	}
+	switch rustTypeForArg(cond.Arg) {
+	case "IntRegister", "FloatRegister":
+		expr += ".index()"
+	case "bool":
+		// Single-bit flags like aq and rl can only be compared as
+		// booleans.
+		if ref {
+			expr = "*" + expr
+		}
+		return fmt.Sprintf("%s %s %t", expr, cmp, cond.Value != 0)
+	case "Ordering":
+		if ref {
+			expr = "*" + expr
+		}
+		expr = fmt.Sprintf("(%s as u8)", expr)
+	default:
+		if ref {
+			expr = "*" + expr
+		}
+	}
+	if cond.Modulus != 0 {
+		return fmt.Sprintf("%s %% %d %s %d", expr, cond.Modulus, cmp, cond.Value)
+	}
+	return fmt.Sprintf("%s %s %d", expr, cmp, cond.Value)
+}
+
+// rustConstFn returns the keyword for declaring a function that is pure
+// bit arithmetic, which is "const fn" if the -const option is set.
+func rustConstFn() string {
+	if *constFns {
+		return "const fn"
+	}
+	return "fn"
+}
+
+func rustTypeForArg(arg *Argument) string {
+	switch {
+	case arg.Type == ArgIntReg, arg.Type == ArgCompressedReg:
 		return "IntRegister"
-	case ArgFloatReg:
+	case arg.Type == ArgFloatReg:
 		return "FloatRegister"
-	case ArgOffset, ArgSignedImmediate:
+	case arg.Type == ArgOrdering:
+		return "Ordering"
+	case arg.IsSigned():
 		return "i32"
+	case arg.EncWidth == 1:
+		return "bool"
 	default:
-		if encWidth == 1 {
-			return "bool"
-		}
 		return "u32"
 	}
 }
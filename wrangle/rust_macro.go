@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rustMacroName is the name of the macro that the file written by
+// generateRustMacroInput invokes, which the consuming crate must define.
+const rustMacroName = "riscv_ops"
+
+// generateRustMacroInput writes the operation table as a single invocation
+// of a macro that the consuming crate defines, rather than as generated
+// enums and decoders, so that the crate's macro can shape the code however
+// it likes. Each entry is written in a form that macro_rules! can match:
+//
+//	$( $(#[$attr:meta])*
+//	   $variant:ident $name:literal $ext:ident [$($base:ident)*]
+//	   $mask:literal $test:literal
+//	   { $($field:ident: $ty:ty = $accessor:ident),* }; )*
+//
+// where each accessor is a method of RawInstruction, as generated in
+// raw_instruction.rs, that returns the operand's value. An operation whose
+// encoding differs between base ISA sizes has one entry for each encoding,
+// all with the same variant.
+func generateRustMacroInput(filename string, isa *ISA, style NameStyle) error {
+	err := os.MkdirAll(filepath.Dir(filename), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	f, err := createOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := newErrWriter(newIndentWriter(f))
+
+	writeFileHeader(w, rustComments)
+	w.Printf("%s! {\n", rustMacroName)
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		ext := '?'
+		if exts := op.Standards.Extensions(); len(exts) != 0 {
+			ext = rune(exts[0])
+		}
+		var bases []string
+		for _, size := range []Size{RV32, RV64, RV128} {
+			if op.Standards.Has(size.Any()) {
+				bases = append(bases, size.Any().String())
+			}
+		}
+		size := op.Standards.MinSize()
+		fields := make([]string, len(op.Codec.Operands))
+		for j, argName := range op.Codec.Operands {
+			arg := isa.Argument(argName, size)
+			fields[j] = arg.FuncLocalName + ": " + rustTypeForArg(arg) + " = " + arg.FuncName
+		}
+
+		w.Printf("    /// %s\n", op.DocText())
+		w.Printf("    %s %q %c [%s]\n", style.RustIdent(op.Name), op.Name, ext, strings.Join(bases, " "))
+		w.Printf("        0x%08x 0x%08x\n", uint32(op.Mask), uint32(op.Test))
+		if len(fields) == 0 {
+			w.WriteString("        {};\n")
+		} else {
+			w.Printf("        { %s };\n", strings.Join(fields, ", "))
+		}
+	}
+	w.WriteString("}\n")
+
+	if err := w.Err(); err != nil {
+		return err
+	}
+	return f.Close()
+}
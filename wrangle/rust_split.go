@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// rustExtensionFragments returns the fragments that replace instruction.rs
+// when the -split-by=extension option is set: one file for each extension,
+// defining an enum of that extension's operations for each base ISA size,
+// and a root instruction.rs that declares those files as modules and wraps
+// their enums in one enum per base ISA size.
+func rustExtensionFragments(isa *ISA, style NameStyle) []rustFragment {
+	exts := rustSplitExtensions(isa)
+	ret := []rustFragment{
+		{"instruction.rs", true, func(w *errWriter) error { return writeRustSplitRoot(w, isa, exts) }},
+	}
+	for _, ext := range exts {
+		ext := ext
+		ret = append(ret, rustFragment{
+			rustExtensionFilename(ext), true,
+			func(w *errWriter) error { return writeRustExtensionOps(w, isa, ext, style) },
+		})
+	}
+	return ret
+}
+
+// rustSplitExtensions returns the extensions that have at least one
+// operation, in the order that the unsplit enums list them.
+func rustSplitExtensions(isa *ISA) []Extension {
+	var ret []Extension
+	for _, ext := range []Extension{ExtI, ExtM, ExtA, ExtS, ExtF, ExtD, ExtQ, ExtC} {
+		if rustExtensionHasOps(isa, MakeStandard(RV32, ext)) || rustExtensionHasOps(isa, MakeStandard(RV64, ext)) {
+			ret = append(ret, ext)
+		}
+	}
+	return ret
+}
+
+func rustExtensionFilename(ext Extension) string {
+	return fmt.Sprintf("op_%s.rs", strings.ToLower(string(rune(ext))))
+}
+
+func rustExtensionModule(ext Extension) string {
+	return strings.TrimSuffix(rustExtensionFilename(ext), ".rs")
+}
+
+// writeRustSplitRoot writes the root of the per-extension files, whose
+// enums have a variant wrapping the operations of each extension.
+func writeRustSplitRoot(w *errWriter, isa *ISA, exts []Extension) error {
+	for _, ext := range exts {
+		w.Printf("#[path = %q]\n", rustExtensionFilename(ext))
+		w.Printf("mod %s;\n", rustExtensionModule(ext))
+		w.Printf("pub use self::%s::*;\n", rustExtensionModule(ext))
+	}
+
+	for _, isaSize := range []Size{RV32, RV64} {
+		var sizeExts []Extension
+		for _, ext := range exts {
+			if rustExtensionHasOps(isa, MakeStandard(isaSize, ext)) {
+				sizeExts = append(sizeExts, ext)
+			}
+		}
+
+		w.WriteString("\n")
+		w.Printf("/// Enumeration of all operations from the RV%d ISA, grouped by extension.\n", int(isaSize))
+		w.WriteString(rustDeriveAttr())
+		w.Printf("pub enum OperationRV%d {\n", int(isaSize))
+		for _, ext := range sizeExts {
+			std := MakeStandard(isaSize, ext)
+			w.Printf("    /// %s: %s\n", std, isa.ExtensionNames[ext])
+			w.Printf("    %c(Operation%s),\n", byte(ext), std)
+		}
+		w.WriteString("}\n\n")
+
+		w.Printf("impl OperationRV%d {\n", int(isaSize))
+		w.WriteString("    /// Returns the length in bytes of the instruction the operation\n")
+		w.WriteString("    /// was decoded from.\n")
+		w.WriteString("    pub fn width(&self) -> usize {\n")
+		w.WriteString("        match self {\n")
+		for _, ext := range sizeExts {
+			w.Printf("            Self::%c(op) => op.width(),\n", byte(ext))
+		}
+		w.WriteString("        }\n")
+		w.WriteString("    }\n\n")
+		w.WriteString("    /// Returns the broad class of the operation.\n")
+		w.WriteString("    pub fn class(&self) -> OpClass {\n")
+		w.WriteString("        match self {\n")
+		for _, ext := range sizeExts {
+			w.Printf("            Self::%c(op) => op.class(),\n", byte(ext))
+		}
+		w.WriteString("        }\n")
+		w.WriteString("    }\n\n")
+		w.WriteString("    /// Checks that all of the operation's operands can be encoded\n")
+		w.WriteString("    /// exactly, returning an error naming the first that cannot.\n")
+		w.WriteString("    pub fn validate(&self) -> Result<(), EncodeError> {\n")
+		w.WriteString("        match self {\n")
+		for _, ext := range sizeExts {
+			w.Printf("            Self::%c(op) => op.validate(),\n", byte(ext))
+		}
+		w.WriteString("        }\n")
+		w.WriteString("    }\n\n")
+		w.WriteString("    /// Decodes a raw instruction as an operation of any of the\n")
+		w.WriteString("    /// extensions, returning None if none of them has a matching\n")
+		w.WriteString("    /// operation.\n")
+		w.WriteString("    pub fn decode_raw(raw: RawInstruction) -> Option<Self> {\n")
+		for _, ext := range sizeExts {
+			w.Printf("        if let Some(op) = Operation%s::decode_raw(raw) {\n", MakeStandard(isaSize, ext))
+			w.Printf("            return Some(Self::%c(op));\n", byte(ext))
+			w.WriteString("        }\n")
+		}
+		w.WriteString("        None\n")
+		w.WriteString("    }\n")
+		w.WriteString("}\n")
+	}
+	writeRustEncodeError(w)
+
+	return w.Err()
+}
+
+// writeRustExtensionOps writes the enums of the operations of the given
+// extension, one for each base ISA size that has the extension, along with
+// a decoder for each.
+func writeRustExtensionOps(w *errWriter, isa *ISA, ext Extension, style NameStyle) error {
+	w.WriteString("use super::*;\n")
+
+	for _, isaSize := range []Size{RV32, RV64} {
+		std := MakeStandard(isaSize, ext)
+		if !rustExtensionHasOps(isa, std) {
+			continue
+		}
+
+		w.WriteString("\n")
+		w.Printf("/// Enumeration of the operations of %s: %s.\n", std, isa.ExtensionNames[ext])
+		w.WriteString(rustDeriveAttr())
+		w.Printf("pub enum Operation%s {\n", std)
+		writeRustOperationVariants(w, isa, std, style, nil)
+		w.WriteString("}\n\n")
+
+		w.Printf("impl Operation%s {\n", std)
+		writeRustWidth(w, isa, std, style)
+		writeRustClass(w, isa, std, style)
+		writeRustValidate(w, isa, std, style)
+		writeRustExtensionDecode(w, isa, std, style)
+		w.WriteString("}\n")
+	}
+
+	return w.Err()
+}
+
+// writeRustExtensionDecode writes a method that decodes a raw instruction
+// as the most specific of the operations of the given standard that it
+// matches. An encoding that matches an operation but violates its operand
+// constraints is reserved, and so doesn't decode at all.
+func writeRustExtensionDecode(w *errWriter, isa *ISA, std Standard, style NameStyle) {
+	var ops []*Operation
+	for i := range isa.Ops {
+		if op := &isa.Ops[i]; op.Standards.Has(std) {
+			ops = append(ops, op)
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Specificity() > ops[j].Specificity()
+	})
+
+	w.WriteString("    /// Decodes a raw instruction as one of the extension's operations,\n")
+	w.WriteString("    /// returning None if it matches none of them.\n")
+	w.WriteString("    pub fn decode_raw(raw: RawInstruction) -> Option<Self> {\n")
+	for _, op := range ops {
+		if op.Parcels() == 1 {
+			w.Printf("        if raw.matches(0b%016b, 0b%016b) {\n", op.Mask, op.Test)
+		} else {
+			w.Printf("        if raw.matches(0b%032b, 0b%032b) {\n", op.Mask, op.Test)
+		}
+		if len(op.Constraints) != 0 {
+			tests := make([]string, len(op.Constraints))
+			for i, cond := range op.Constraints {
+				tests[i] = rustConditionExpr(cond, "raw."+cond.Arg.ForSize(std.Size()).FuncName+"()", false)
+			}
+			w.Printf("            if !(%s) {\n", strings.Join(tests, " && "))
+			w.WriteString("                return None;\n")
+			w.WriteString("            }\n")
+		}
+		if len(op.Codec.Operands) == 0 {
+			w.Printf("            return Some(Self::%s);\n", style.RustIdent(op.Name))
+		} else {
+			w.Printf("            return Some(Self::%s {\n", style.RustIdent(op.Name))
+			for _, argName := range op.Codec.Operands {
+				arg := isa.Argument(argName, std.Size())
+				w.Printf("                %s: raw.%s(),\n", arg.FuncLocalName, arg.FuncName)
+			}
+			w.WriteString("            });\n")
+		}
+		w.WriteString("        }\n")
+	}
+	w.WriteString("        None\n")
+	w.WriteString("    }\n")
+}
+
+func rustExtensionHasOps(isa *ISA, std Standard) bool {
+	for _, op := range isa.Ops {
+		if op.Standards.Has(std) {
+			return true
+		}
+	}
+	return false
+}
+
+// rustDecodeTarget describes the values that the generated decoders and
+// interpreter use for the operations of one base ISA size. The unsplit
+// enums have a variant for each operation and an Invalid variant, while
+// under -split-by=extension each variant wraps the enum of an extension and
+// the decoders return None for an instruction that isn't valid.
+type rustDecodeTarget struct {
+	size Size
+
+	// exts are the extensions of the split enums, or nil if the enums
+	// aren't split.
+	exts []Extension
+}
+
+func newRustDecodeTarget(isa *ISA, size Size) rustDecodeTarget {
+	ret := rustDecodeTarget{size: size}
+	if *splitBy == "extension" {
+		for _, ext := range rustSplitExtensions(isa) {
+			if rustExtensionHasOps(isa, MakeStandard(size, ext)) {
+				ret.exts = append(ret.exts, ext)
+			}
+		}
+	}
+	return ret
+}
+
+// Split returns true if the enums are split by extension.
+func (t rustDecodeTarget) Split() bool {
+	return t.exts != nil
+}
+
+// ResultType returns the type that a decoder returns.
+func (t rustDecodeTarget) ResultType() string {
+	if t.Split() {
+		return "Option<Self>"
+	}
+	return "Self"
+}
+
+// Invalid returns the value that a decoder returns for an instruction that
+// isn't valid.
+func (t rustDecodeTarget) Invalid() string {
+	if t.Split() {
+		return "None"
+	}
+	return "Self::Invalid"
+}
+
+// Includes returns true if the enums have a variant for the operation. The
+// split enums have none for an operation of an extension without its own
+// file.
+func (t rustDecodeTarget) Includes(op *Operation) bool {
+	return !t.Split() || t.extension(op) != ExtInvalid
+}
+
+// extension returns the first of the split extensions that the operation
+// belongs to, whose enum is the one the decoders produce for it.
+func (t rustDecodeTarget) extension(op *Operation) Extension {
+	for _, ext := range t.exts {
+		if op.Standards.Has(MakeStandard(t.size, ext)) {
+			return ext
+		}
+	}
+	return ExtInvalid
+}
+
+// Variant returns the text that comes before and after the fields of the
+// variant for the operation in the given enum, for use in both patterns
+// and values.
+func (t rustDecodeTarget) Variant(enum string, op *Operation, style NameStyle) (string, string) {
+	name := style.RustIdent(op.Name)
+	if !t.Split() {
+		return enum + "::" + name, ""
+	}
+	ext := t.extension(op)
+	return fmt.Sprintf("%s::%c(Operation%s::%s", enum, byte(ext), MakeStandard(t.size, ext), name), ")"
+}
+
+// Value is like Variant, but for the value that a decoder returns for the
+// operation.
+func (t rustDecodeTarget) Value(op *Operation, style NameStyle) (string, string) {
+	open, close := t.Variant("Self", op, style)
+	if t.Split() {
+		return "Some(" + open, close + ")"
+	}
+	return open, close
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRustSharedOperandsSize(t *testing.T) {
+	defer func(prev bool) { *sharedOperands = prev }(*sharedOperands)
+
+	isa := loadTestISA(t)
+	*sharedOperands = false
+	inline := len(generateTestFiles(t, "rust", isa)["instruction.rs"])
+	*sharedOperands = true
+	shared := len(generateTestFiles(t, "rust", isa)["instruction.rs"])
+
+	if inline == 0 || shared == 0 {
+		t.Fatal("instruction.rs was not generated")
+	}
+	t.Logf("instruction.rs is %d bytes inline and %d bytes with shared operands (%.1f%% smaller)", inline, shared, 100*float64(inline-shared)/float64(inline))
+	if shared >= inline {
+		t.Errorf("shared operand extraction doesn't shrink instruction.rs: %d bytes, against %d inline", shared, inline)
+	}
+}
+
+// rustTestStubs defines the items that the generated Rust code expects the
+// consuming crate to provide, just well enough for it to compile.
+const rustTestStubs = `
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct IntRegister(u8);
+impl IntRegister {
+    pub fn num(n: usize) -> Self { Self(n as u8) }
+    pub fn index(&self) -> usize { self.0 as usize }
+}
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct FloatRegister(u8);
+impl FloatRegister {
+    pub fn num(n: usize) -> Self { Self(n as u8) }
+    pub fn index(&self) -> usize { self.0 as usize }
+}
+pub type Op = riscv::OperationRV32;
+pub struct Instruction<O, W> { pub op: O, pub raw: W }
+pub trait Bus<A> {}
+pub trait Hart<A, X, F, M> { fn exception(&mut self, cause: ExceptionCause); }
+pub enum ExceptionCause { IllegalInstruction }
+fn sign_extend(v: u32, width: u32) -> i32 { ((v << (32 - width)) as i32) >> (32 - width) }
+`
+
+func TestRustSingleFileCompiles(t *testing.T) {
+	defer func(prev bool) { *singleFile = prev }(*singleFile)
+
+	isa := loadTestISA(t)
+	*singleFile = true
+	src := string(generateTestFiles(t, "rust", isa)["riscv.rs"])
+	if src == "" {
+		t.Fatal("riscv.rs was not generated")
+	}
+
+	// These are the items that the decoders rely on, which must be
+	// generated even when rustc isn't available to check the whole file.
+	for _, want := range []string{
+		"#[repr(u8)]\npub enum Opcode {\n",
+		"pub fn matches(&self, mask: u32, test: u32) -> bool {\n",
+		"    Invalid,\n}\n\nimpl OperationRV32 {\n",
+		"    Invalid,\n}\n\nimpl OperationRV64 {\n",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("riscv.rs does not contain %q", want)
+		}
+	}
+
+	checkRustCompiles(t, map[string][]byte{"lib.rs": []byte(rustTestStubs + src)})
+}
+
+func TestRustSplitCompiles(t *testing.T) {
+	defer func(prev string) { *splitBy = prev }(*splitBy)
+
+	isa := loadTestISA(t)
+	*splitBy = "extension"
+	files := generateTestFiles(t, "rust", isa)
+
+	// The split enums have no Invalid variant, so the decoders of the
+	// other fragments must return an Option instead.
+	for filename, want := range map[string]string{
+		"dispatch.rs":   "pub fn decode_dispatch(raw: RawInstruction) -> Option<Self> {\n",
+		"compressed.rs": "pub fn decode_compressed(parcel: u16) -> Option<Self> {\n",
+		"exec32.rs":     "Op::I(OperationRV32I::Addi { ",
+	} {
+		if !strings.Contains(string(files[filename]), want) {
+			t.Errorf("%s does not contain %q", filename, want)
+		}
+	}
+
+	// The fragments are included at the root of the crate, where the
+	// split instruction.rs finds the files of its extension modules.
+	var lib strings.Builder
+	lib.WriteString(strings.Replace(rustTestStubs, "riscv::", "", 1))
+	for filename := range files {
+		if !strings.HasPrefix(filename, "op_") {
+			fmt.Fprintf(&lib, "include!(%q);\n", filename)
+		}
+	}
+	files["lib.rs"] = []byte(lib.String())
+	checkRustCompiles(t, files)
+}
+
+// checkRustCompiles writes the given files into a temporary directory and
+// checks that rustc can compile the crate rooted at lib.rs among them,
+// skipping the test if rustc isn't available.
+func checkRustCompiles(t *testing.T, files map[string][]byte) {
+	t.Helper()
+	rustc, err := exec.LookPath("rustc")
+	if err != nil {
+		t.Skip("rustc is not available")
+	}
+	dir := t.TempDir()
+	for filename, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, filename), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(rustc, "--edition", "2021", "--crate-type", "lib", "--emit", "metadata", "-A", "warnings", "-o", filepath.Join(dir, "lib.rmeta"), filepath.Join(dir, "lib.rs"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("rustc failed: %s\n%s", err, out)
+	}
+}
+
+func TestRustExecDocComments(t *testing.T) {
+	isa := loadTestISA(t)
+	src := string(generateTestFiles(t, "rust", isa)["exec32.rs"])
+	if src == "" {
+		t.Fatal("exec32.rs was not generated")
+	}
+	// Operations without a full name or description used to get empty
+	// comments, with an empty quote of their missing pseudocode.
+	for _, bad := range []string{"\n// : .\n", "\n// > \n"} {
+		if n := strings.Count(src, bad); n != 0 {
+			t.Errorf("exec32.rs has %d empty comments %q", n, bad)
+		}
+	}
+}
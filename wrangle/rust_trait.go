@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// writeRustInstructionTrait writes the RiscvInstruction trait, which
+// abstracts over the operation enums of the different base ISA sizes, along
+// with its implementations for each of those enums. The operand encoders are
+// shared by all of the implementations, since most operands are encoded the
+// same way regardless of the base ISA size. The trait isn't named
+// Instruction because that name belongs to the executor's instruction type.
+func writeRustInstructionTrait(w *errWriter, isa *ISA, style NameStyle) error {
+	w.WriteString(`/// The behavior common to operations of all base ISA sizes, for tools
+/// that handle both RV32 and RV64 with the same code.
+pub trait RiscvInstruction {
+    /// Returns the major opcode of the operation, or None for a compressed
+    /// operation, which has no major opcode.
+    fn opcode(&self) -> Option<Opcode>;
+
+    /// Returns the operation in assembly syntax, with its operands in the
+    /// same order as its fields.
+    fn to_asm(&self) -> String;
+
+    /// Returns the instruction word that encodes the operation, with the
+    /// upper parcel zero for a compressed operation. Operand values that
+    /// don't fit their fields are truncated, so callers that can't be sure
+    /// of them should call validate first.
+    fn encode(&self) -> u32;
+}
+
+`)
+
+	// Each encoder places the bits of an operand's value into their
+	// positions in the instruction word, inverting the corresponding
+	// accessor of RawInstruction.
+	for _, arg := range sortedArgEncodings(isa.Arguments) {
+		var terms []string
+		for i, step := range arg.Decoding {
+			maskName := arg.MaskConstName(i, NameSnake)
+			switch {
+			case step.RightShift == 0:
+				terms = append(terms, fmt.Sprintf("(v & %s)", maskName))
+			case step.RightShift < 0:
+				terms = append(terms, fmt.Sprintf("((v >> %d) & %s)", -step.RightShift, maskName))
+			default:
+				terms = append(terms, fmt.Sprintf("((v << %d) & %s)", step.RightShift, maskName))
+			}
+		}
+		if len(terms) == 1 {
+			terms[0] = strings.TrimSuffix(strings.TrimPrefix(terms[0], "("), ")")
+		}
+		w.Printf("fn %s(v: u32) -> u32 {\n", rustOperandEncoder(arg))
+		w.Printf("    %s\n", strings.Join(terms, " | "))
+		w.WriteString("}\n\n")
+	}
+
+	for _, isaSize := range []Size{RV32, RV64} {
+		typeName := fmt.Sprintf("OperationRV%d", int(isaSize))
+		if *splitBy != "extension" {
+			writeRustInstructionImpl(w, isa, typeName, isaSize.Any(), style)
+			continue
+		}
+
+		// The split enums wrap an enum for each extension, which each
+		// get their own implementation for the wrapper to delegate to.
+		var sizeExts []Extension
+		for _, ext := range rustSplitExtensions(isa) {
+			std := MakeStandard(isaSize, ext)
+			if rustExtensionHasOps(isa, std) {
+				sizeExts = append(sizeExts, ext)
+				writeRustInstructionImpl(w, isa, "Operation"+std.String(), std, style)
+			}
+		}
+		w.Printf("\nimpl RiscvInstruction for %s {\n", typeName)
+		methods := []struct{ Name, Result string }{
+			{"opcode", "Option<Opcode>"},
+			{"to_asm", "String"},
+			{"encode", "u32"},
+		}
+		for i, method := range methods {
+			if i > 0 {
+				w.WriteString("\n")
+			}
+			w.Printf("    fn %s(&self) -> %s {\n", method.Name, method.Result)
+			w.WriteString("        match self {\n")
+			for _, ext := range sizeExts {
+				w.Printf("            Self::%c(op) => op.%s(),\n", byte(ext), method.Name)
+			}
+			w.WriteString("        }\n")
+			w.WriteString("    }\n")
+		}
+		w.WriteString("}\n")
+	}
+
+	return w.Err()
+}
+
+// rustOperandEncoder returns the name of the function that encodes the
+// given argument into an instruction word.
+func rustOperandEncoder(arg *Argument) string {
+	return "encode_" + arg.FuncName
+}
+
+// writeRustInstructionImpl writes the implementation of the
+// RiscvInstruction trait for the named enum, whose variants are the
+// operations belonging to the given standard.
+func writeRustInstructionImpl(w *errWriter, isa *ISA, typeName string, std Standard, style NameStyle) {
+	isaSize := std.Size()
+	var ops []*Operation
+	for i := range isa.Ops {
+		if op := &isa.Ops[i]; op.Standards.Has(std) {
+			ops = append(ops, op)
+		}
+	}
+
+	w.Printf("\nimpl RiscvInstruction for %s {\n", typeName)
+
+	byOpcode := make(map[*MajorOpcode][]string)
+	for _, op := range ops {
+		if op.Parcels() == 1 {
+			continue
+		}
+		if majorOp := isa.MajorOpcodes[bits8(op.Test&0x7f)]; majorOp != nil {
+			byOpcode[majorOp] = append(byOpcode[majorOp], fmt.Sprintf("Self::%s { .. }", style.RustIdent(op.Name)))
+		}
+	}
+	w.WriteString("    fn opcode(&self) -> Option<Opcode> {\n")
+	w.WriteString("        match self {\n")
+	for _, majorOp := range sortedMajorOpcodes(isa.MajorOpcodes) {
+		if variants := byOpcode[majorOp]; len(variants) != 0 {
+			w.Printf("            %s => Some(Opcode::%s),\n", strings.Join(variants, "\n            | "), style.RustIdent(majorOp.Name))
+		}
+	}
+	w.WriteString("            _ => None,\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	// The assembly syntax follows formatInstruction, except that returns
+	// aren't special-cased.
+	w.WriteString("    fn to_asm(&self) -> String {\n")
+	w.WriteString("        match self {\n")
+	for _, op := range ops {
+		variant := style.RustIdent(op.Name)
+		mnemonic := fmt.Sprintf("%q", renderMnemonic(op.Name, mnemonicStyle))
+		var fields, operands []string
+		for _, argName := range op.Codec.Operands {
+			arg := isa.Argument(argName, isaSize)
+			switch {
+			case arg.Type == ArgOrdering:
+				// The ordering is a suffix of the mnemonic, which must be
+				// rendered along with the rest of it, so we list every
+				// combination.
+				fields = append(fields, arg.FuncLocalName)
+				var arms []string
+				for i, ordering := range []string{"Relaxed", "Release", "Acquire", "AcquireRelease"} {
+					arms = append(arms, fmt.Sprintf("Ordering::%s => %q", ordering, renderMnemonic(op.Name+orderingSuffixes[i], mnemonicStyle)))
+				}
+				mnemonic = fmt.Sprintf("match *%s { %s }", arg.FuncLocalName, strings.Join(arms, ", "))
+			case isImplicitArg(op, arg):
+			case arg.Type == ArgCompressedReg:
+				// Compressed register fields select from the registers
+				// starting at x8 (or f8), as for formatOperand.
+				ty := rustTypeForArg(arg)
+				if strings.HasPrefix(arg.Name, "cf") {
+					ty = "FloatRegister"
+				}
+				fields = append(fields, arg.FuncLocalName)
+				operands = append(operands, fmt.Sprintf("%s::num(%s.index() + 8)", ty, arg.FuncLocalName))
+			default:
+				fields = append(fields, arg.FuncLocalName)
+				operands = append(operands, arg.FuncLocalName)
+			}
+		}
+		fields = append(fields, "..")
+		if len(operands) == 0 {
+			w.Printf("            Self::%s { %s } => String::from(%s),\n", variant, strings.Join(fields, ", "), mnemonic)
+			continue
+		}
+		verbs := strings.Repeat(", {}", len(operands))[2:]
+		if name := renderMnemonic(op.Name, mnemonicStyle); mnemonic == fmt.Sprintf("%q", name) {
+			w.Printf("            Self::%s { %s } => format!(\"%s %s\", %s),\n", variant, strings.Join(fields, ", "), name, verbs, strings.Join(operands, ", "))
+			continue
+		}
+		w.Printf("            Self::%s { %s } => format!(\"{} %s\", %s, %s),\n", variant, strings.Join(fields, ", "), verbs, mnemonic, strings.Join(operands, ", "))
+	}
+	w.WriteString("            _ => String::from(\"invalid\"),\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n\n")
+
+	w.WriteString("    fn encode(&self) -> u32 {\n")
+	w.WriteString("        match self {\n")
+	for _, op := range ops {
+		variant := style.RustIdent(op.Name)
+		if len(op.Codec.Operands) == 0 {
+			w.Printf("            Self::%s => 0x%08x,\n", variant, uint32(op.Test))
+			continue
+		}
+		var fields []string
+		terms := []string{fmt.Sprintf("0x%08x", uint32(op.Test))}
+		for _, argName := range op.Codec.Operands {
+			arg := isa.Argument(argName, isaSize)
+			fields = append(fields, arg.FuncLocalName)
+			value := fmt.Sprintf("*%s as u32", arg.FuncLocalName)
+			switch rustTypeForArg(arg) {
+			case "IntRegister", "FloatRegister":
+				value = arg.FuncLocalName + ".index() as u32"
+			}
+			terms = append(terms, fmt.Sprintf("%s(%s)", rustOperandEncoder(arg), value))
+		}
+		w.Printf("            Self::%s { %s } => {\n", variant, strings.Join(fields, ", "))
+		w.Printf("                %s\n", strings.Join(terms, "\n                    | "))
+		w.WriteString("            }\n")
+	}
+	// An invalid operation has no encoding, so it encodes as the all-zero
+	// word, which is itself defined to be illegal.
+	w.WriteString("            _ => 0,\n")
+	w.WriteString("        }\n")
+	w.WriteString("    }\n")
+	w.WriteString("}\n")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sort"
+)
+
+// Go randomizes the iteration order of maps, so generators must use the
+// helpers in this file whenever they iterate over one of the ISA's maps.
+// Otherwise the generated files would differ between runs even when the
+// spec hasn't changed.
+
+// sortedArgNames returns the names of the given arguments in lexical order.
+func sortedArgNames(args map[string]*Argument) []string {
+	ret := make([]string, 0, len(args))
+	for name := range args {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// sortedCodecNames returns the names of the given codecs in lexical order.
+func sortedCodecNames(codecs map[string]*Codec) []string {
+	ret := make([]string, 0, len(codecs))
+	for name := range codecs {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// sortedStringKeys returns the keys of the given map in lexical order.
+func sortedStringKeys(m map[string]string) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// sortedMajorOpcodes returns the given major opcodes ordered by their
+// opcode numbers.
+func sortedMajorOpcodes(majors map[bits8]*MajorOpcode) []*MajorOpcode {
+	ret := make([]*MajorOpcode, 0, len(majors))
+	for _, majorOp := range majors {
+		ret = append(ret, majorOp)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Num < ret[j].Num
+	})
+	return ret
+}
+
+// sortedUnique returns the distinct strings of the given slice in lexical
+// order. The result is never nil, so that it encodes as an empty JSON
+// array rather than null.
+func sortedUnique(strs []string) []string {
+	seen := make(map[string]struct{})
+	ret := []string{}
+	for _, s := range strs {
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		ret = append(ret, s)
+	}
+	sort.Strings(ret)
+	return ret
+}
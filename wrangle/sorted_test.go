@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeneratorsDeterministic(t *testing.T) {
+	for _, name := range backendNames() {
+		t.Run(name, func(t *testing.T) {
+			// Each run loads the spec afresh, so that the loader's map
+			// iteration order varies between the runs too.
+			first := generateTestFiles(t, name, loadTestISA(t))
+			second := generateTestFiles(t, name, loadTestISA(t))
+
+			if len(first) == 0 {
+				t.Fatal("generated no files")
+			}
+			if len(first) != len(second) {
+				t.Fatalf("generated %d files, then %d", len(first), len(second))
+			}
+			for filename, want := range first {
+				got, ok := second[filename]
+				if !ok {
+					t.Errorf("%s was generated only the first time", filename)
+					continue
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s differs between runs", filename)
+				}
+			}
+		})
+	}
+}
+
+// generateTestFiles runs the named backend into a temporary directory and
+// returns the contents of each of the files it generated, keyed by their
+// paths relative to that directory.
+func generateTestFiles(t *testing.T, backend string, isa *ISA) map[string][]byte {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := backendGenerators[backend](dir, isa, NamePascal); err != nil {
+		t.Fatalf("failed to generate: %s", err)
+	}
+
+	ret := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		ret[rel], err = os.ReadFile(path)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
@@ -7,6 +7,7 @@ import (
 )
 
 type Extension byte
+type ExtensionStatus string
 type Size uint8
 type Standard uint16
 type Standards map[Standard]struct{}
@@ -30,6 +31,11 @@ const (
 	ExtC       Extension = 'C' // compressed
 )
 
+const (
+	ExtRatified ExtensionStatus = "ratified"
+	ExtDraft    ExtensionStatus = "draft"
+)
+
 const (
 	Invalid = Standard(0)
 
@@ -94,6 +100,48 @@ func (ss Standards) Add(s Standard) {
 	ss[s] = struct{}{}
 }
 
+// MinSize returns the smallest base ISA size of any of the standards in
+// the set, or RVInvalid if the set is empty.
+func (ss Standards) MinSize() Size {
+	ret := RVInvalid
+	for s := range ss {
+		if size := s.Size(); ret == RVInvalid || size < ret {
+			ret = size
+		}
+	}
+	return ret
+}
+
+// HasExtension returns true if any of the standards in the set belong to
+// the given extension, for any base ISA size.
+func (ss Standards) HasExtension(e Extension) bool {
+	for s := range ss {
+		if s.Extension() == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Extensions returns the distinct extensions of the standards in the set,
+// in alphabetical order.
+func (ss Standards) Extensions() []Extension {
+	seen := make(map[Extension]struct{})
+	var ret []Extension
+	for s := range ss {
+		ext := s.Extension()
+		if _, ok := seen[ext]; ok || ext == ExtInvalid {
+			continue
+		}
+		seen[ext] = struct{}{}
+		ret = append(ret, ext)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i] < ret[j]
+	})
+	return ret
+}
+
 func (ss Standards) String() string {
 	var ssList []Standard
 	for s := range ss {
@@ -112,7 +160,19 @@ func (ss Standards) String() string {
 	return buf.String()
 }
 
+// MakeStandard returns the standard for the given extension under the given
+// base ISA size, or for any extension if e is ExtInvalid. It returns Invalid
+// if the size isn't one of the base ISA sizes or the extension isn't an
+// uppercase letter.
 func MakeStandard(s Size, e Extension) Standard {
+	switch s {
+	case RV32, RV64, RV128:
+	default:
+		return Invalid
+	}
+	if e != ExtInvalid && (e < 'A' || e > 'Z') {
+		return Invalid
+	}
 	return Standard(uint16(s) | uint16(e)<<8)
 }
 
@@ -134,13 +194,55 @@ func ParseStandard(s string) Standard {
 	}
 	ext := Extension(strings.ToUpper(string(s[len(s)-1]))[0])
 
-	return Standard(uint16(bits) | uint16(ext)<<8)
+	return MakeStandard(bits, ext)
+}
+
+// ParseExtensions parses a list of extension letters, such as "IMAC" or
+// "i,m,a,c", as used on the command line. The list may be prefixed with a
+// base ISA size, as in "rv32imac", which is returned as size; without one,
+// size is RVInvalid.
+func ParseExtensions(s string) (Size, []Extension, error) {
+	s = strings.ToUpper(s)
+	size := RVInvalid
+	if strings.HasPrefix(s, "RV") {
+		rest := strings.TrimLeft(s[2:], "0123456789")
+		switch digits := s[2 : len(s)-len(rest)]; digits {
+		case "32":
+			size = RV32
+		case "64":
+			size = RV64
+		case "128":
+			size = RV128
+		default:
+			return RVInvalid, nil, fmt.Errorf("invalid base ISA size %q: must be 32, 64, or 128", "rv"+digits)
+		}
+		s = rest
+	}
+	var ret []Extension
+	for _, r := range s {
+		switch {
+		case r == ',' || r == ' ':
+			continue
+		case r < 'A' || r > 'Z':
+			return RVInvalid, nil, fmt.Errorf("invalid extension letter %q", r)
+		}
+		ret = append(ret, Extension(r))
+	}
+	return size, ret, nil
 }
 
 func (e Extension) String() string {
 	return string(e)
 }
 
+// Bytes returns the width in bytes of the registers of the base ISA size,
+// such as 4 for RV32.
+func (s Size) Bytes() int {
+	return int(s) / 8
+}
+
+// Any returns the standard that matches any extension under the base ISA
+// size, or Invalid if the size isn't one of the base ISA sizes.
 func (s Size) Any() Standard {
 	return MakeStandard(s, ExtInvalid)
 }
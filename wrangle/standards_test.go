@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMakeStandard(t *testing.T) {
+	tests := []struct {
+		size Size
+		ext  Extension
+		want Standard
+	}{
+		{RV32, ExtI, RV32I},
+		{RV32, ExtC, RV32C},
+		{RV64, ExtM, RV64M},
+		{RV64, ExtD, RV64D},
+		{RV128, ExtQ, RV128Q},
+		{RV32, ExtInvalid, RV32Any},
+		{RV64, ExtInvalid, RV64Any},
+		{RV128, ExtInvalid, RV128Any},
+		{RV32, 'V', Standard(uint16(RV32) | uint16('V')<<8)},
+
+		// Invalid combinations
+		{RVInvalid, ExtI, Invalid},
+		{RVInvalid, ExtInvalid, Invalid},
+		{Size(16), ExtI, Invalid},
+		{Size(33), ExtI, Invalid},
+		{RV32, 'i', Invalid},
+		{RV64, '1', Invalid},
+		{RV128, '[', Invalid},
+	}
+
+	for _, test := range tests {
+		got := MakeStandard(test.size, test.ext)
+		if got != test.want {
+			t.Errorf("MakeStandard(%d, %q) = %s; want %s", int(test.size), rune(test.ext), got, test.want)
+			continue
+		}
+		if got != Invalid && (got.Size() != test.size || got.Extension() != test.ext) {
+			t.Errorf("MakeStandard(%d, %q) has size %d and extension %q", int(test.size), rune(test.ext), int(got.Size()), rune(got.Extension()))
+		}
+	}
+}
+
+func TestSizeAny(t *testing.T) {
+	tests := []struct {
+		size Size
+		want Standard
+	}{
+		{RV32, RV32Any},
+		{RV64, RV64Any},
+		{RV128, RV128Any},
+		{RVInvalid, Invalid},
+		{Size(48), Invalid},
+	}
+
+	for _, test := range tests {
+		if got := test.size.Any(); got != test.want {
+			t.Errorf("Size(%d).Any() = %s; want %s", int(test.size), got, test.want)
+		}
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	tests := []struct {
+		raw      string
+		wantSize Size
+		wantExts string
+		wantErr  bool
+	}{
+		{"IMAC", RVInvalid, "IMAC", false},
+		{"i,m,a,c", RVInvalid, "IMAC", false},
+		{"rv32m", RV32, "M", false},
+		{"RV64IMAFD", RV64, "IMAFD", false},
+		{"rv128i", RV128, "I", false},
+		{"rv16i", RVInvalid, "", true},
+		{"rvi", RVInvalid, "", true},
+		{"i2", RVInvalid, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			size, exts, err := ParseExtensions(test.raw)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("unexpected success; want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var got strings.Builder
+			for _, ext := range exts {
+				got.WriteString(ext.String())
+			}
+			if size != test.wantSize || got.String() != test.wantExts {
+				t.Errorf("wrong result\ngot:  RV%d %s\nwant: RV%d %s", int(size), got.String(), int(test.wantSize), test.wantExts)
+			}
+		})
+	}
+}
+
+func TestFilterExtensionsSize(t *testing.T) {
+	isa := loadTestISA(t)
+	isa.FilterExtensions(RV32, []Extension{ExtM, ExtI})
+
+	for _, name := range []string{"mul", "addi"} {
+		if findTestOp(isa, name) == nil {
+			t.Errorf("%s was removed; want it kept for RV32", name)
+		}
+	}
+	for _, name := range []string{"mulw", "ld", "addiw"} {
+		if findTestOp(isa, name) != nil {
+			t.Errorf("%s was kept; want it removed because it's not in RV32", name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"text/tabwriter"
+)
+
+// allArgTypes is the order in which we report the argument types in
+// summary output.
+var allArgTypes = []ArgType{
+	ArgIntReg,
+	ArgFloatReg,
+	ArgCompressedReg,
+	ArgOffset,
+	ArgSignedImmediate,
+	ArgUnsignedImmediate,
+	ArgOrdering,
+	ArgGeneral,
+}
+
+type extensionStats struct {
+	Ops          int
+	FullNames    int
+	Descriptions int
+	Pseudocode   int
+	ArgTypes     map[ArgType]int
+}
+
+func printStats(w io.Writer, isa *ISA) error {
+	stats := make(map[Extension]*extensionStats)
+
+	for _, op := range isa.Ops {
+		// An operation is often tagged with the same extension for several
+		// different base ISA sizes, but we want to count it only once.
+		exts := make(map[Extension]struct{})
+		for std := range op.Standards {
+			if ext := std.Extension(); ext != ExtInvalid {
+				exts[ext] = struct{}{}
+			}
+		}
+
+		for ext := range exts {
+			st := stats[ext]
+			if st == nil {
+				st = &extensionStats{
+					ArgTypes: make(map[ArgType]int),
+				}
+				stats[ext] = st
+			}
+			st.Ops++
+			if op.FullName != "" {
+				st.FullNames++
+			}
+			if op.Description != "" {
+				st.Descriptions++
+			}
+			if op.Pseudocode != "" {
+				st.Pseudocode++
+			}
+			for _, argName := range op.Codec.Operands {
+				arg := isa.Arguments[argName]
+				if arg == nil {
+					continue
+				}
+				st.ArgTypes[arg.Type]++
+			}
+		}
+	}
+
+	exts := make([]Extension, 0, len(stats))
+	for ext := range stats {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		return exts[i] < exts[j]
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "EXT\tOPS\tNAMES\tDESCS\tPSEUDO\t")
+	for _, ty := range allArgTypes {
+		fmt.Fprintf(tw, "%s\t", ty)
+	}
+	fmt.Fprint(tw, "\n")
+	for _, ext := range exts {
+		st := stats[ext]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t", ext, st.Ops, st.FullNames, st.Descriptions, st.Pseudocode)
+		for _, ty := range allArgTypes {
+			fmt.Fprintf(tw, "%d\t", st.ArgTypes[ty])
+		}
+		fmt.Fprint(tw, "\n")
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	// Operations are also counted by category, once per distinct name.
+	categories := make(map[string]int)
+	seen := make(map[string]struct{})
+	for i := range isa.Ops {
+		op := &isa.Ops[i]
+		if _, ok := seen[op.Name]; ok {
+			continue
+		}
+		seen[op.Name] = struct{}{}
+		categories[op.Category(isa)]++
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "CATEGORY\tOPS\t\n")
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+	for _, category := range names {
+		fmt.Fprintf(tw, "%s\t%d\t\n", category, categories[category])
+	}
+	return tw.Flush()
+}
+
+// logGeneratedSummary logs how many operations of each standard were
+// included in generated code for the given base ISA sizes, so that the
+// effect of any extension filter can be confirmed.
+func logGeneratedSummary(isa *ISA, sizes []Size) {
+	total := 0
+	for _, op := range isa.Ops {
+		for _, size := range sizes {
+			if op.Standards.Has(size.Any()) {
+				total++
+				break
+			}
+		}
+	}
+
+	for _, size := range sizes {
+		for _, ext := range []Extension{ExtI, ExtM, ExtA, ExtS, ExtF, ExtD, ExtQ, ExtC} {
+			std := MakeStandard(size, ext)
+			count := 0
+			for _, op := range isa.Ops {
+				if op.Standards.Has(std) {
+					count++
+				}
+			}
+			if count != 0 {
+				log.Printf("%s: %d operations generated", std, count)
+			}
+		}
+	}
+	log.Printf("total: %d operations generated, %d excluded by extension filter", total, len(isa.ExcludedOps))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// upstreamArgAliases maps the operand names used in the current upstream
+// riscv-opcodes files to the names used in our own operands file. Upstream
+// splits some immediates into separately-named pieces, each of which maps
+// to the same operand here, as do the separate aq and rl bits.
+var upstreamArgAliases = map[string]string{
+	"bimm12hi": "sbimm12",
+	"bimm12lo": "sbimm12",
+	"imm12hi":  "simm12",
+	"imm12lo":  "simm12",
+	"shamtw":   "shamt5",
+	"shamtd":   "shamt6",
+	"shamtq":   "shamt",
+	"fm":       "",
+	"aq":       "aqrl",
+	"rl":       "aqrl",
+}
+
+// loadUpstreamOperations loads all of the instruction files from a checkout
+// of the upstream riscv-opcodes repository, using loadOperationsV2.
+func loadUpstreamOperations(dir string, majors map[bits8]*MajorOpcode, codecs map[string]*Codec, fullNames map[string]string, descs map[string]string, pseudocode map[string]string, pseudocodeC map[string]string) ([]Operation, error) {
+	filenames, err := filepath.Glob(filepath.Join(dir, "rv*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Operation
+	for _, filename := range filenames {
+		stds, ok := upstreamFileStandards(filepath.Base(filename))
+		if !ok {
+			if *verbose {
+				log.Printf("%s: skipping file for unsupported extension", filename)
+			}
+			continue
+		}
+		ops, err := loadOperationsV2(hostFS{}, filename, stds, majors, codecs, fullNames, descs, pseudocode, pseudocodeC)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+		ret = append(ret, ops...)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// upstreamFileStandards returns the standards implied by the name of an
+// upstream instruction file, such as "rv_i" or "rv64_m". Only single-letter
+// extensions are supported, because that's all Extension can represent.
+func upstreamFileStandards(name string) ([]Standard, bool) {
+	rawSize, rawExt := partition(name, "_")
+	if len(rawExt) != 1 || !unicode.IsLetter(rune(rawExt[0])) {
+		return nil, false
+	}
+	ext := Extension(strings.ToUpper(rawExt)[0])
+
+	// A file for a particular size also applies to all of the larger
+	// sizes, unless it's specifically for RV32.
+	var sizes []Size
+	switch rawSize {
+	case "rv":
+		sizes = []Size{RV32, RV64, RV128}
+	case "rv32":
+		sizes = []Size{RV32}
+	case "rv64":
+		sizes = []Size{RV64, RV128}
+	case "rv128":
+		sizes = []Size{RV128}
+	default:
+		return nil, false
+	}
+
+	ret := make([]Standard, len(sizes))
+	for i, size := range sizes {
+		ret[i] = MakeStandard(size, ext)
+	}
+	return ret, true
+}
+
+// loadOperationsV2 is like loadOperations, but reads the dialect used in
+// the current upstream riscv-opcodes repository rather than the dialect of
+// our own opcodes file.
+//
+// In that dialect each line has only the name, operands, and match specs:
+// the standards are implied by the filename and passed in as stds, and
+// the codec is inferred from the operands. Pseudo-operation and import
+// directives are skipped, since the operations they refer to will be loaded
+// from their own files.
+func loadOperationsV2(fsys fs.FS, filename string, stds []Standard, majors map[bits8]*MajorOpcode, codecs map[string]*Codec, fullNames map[string]string, descs map[string]string, pseudocode map[string]string, pseudocodeC map[string]string) ([]Operation, error) {
+	r, err := openSpecFile(fsys, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Several of our codecs have the same operands, so we'll prefer the
+	// one whose name sorts first for consistency.
+	codecNames := sortedCodecNames(codecs)
+
+	var ret []Operation
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := trimComments(sc.Text())
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "$") {
+			continue
+		}
+		name := fields[0]
+
+		op := Operation{
+			FullName:    fullNames[name],
+			Description: descs[name],
+			Pseudocode:  pseudocode[name],
+			PseudocodeC: pseudocodeC[name],
+			Name:        name,
+			FuncName:    makeIdentUnderscores(name),
+			TypeName:    makeIdentTitle(name),
+
+			Standards: make(Standards),
+		}
+
+		var operands []string
+		for _, raw := range fields[1:] {
+			if unicode.IsDigit(rune(raw[0])) {
+				v, mask, ignore, err := parseMatchSpec(raw)
+				if err != nil {
+					warnSpec("%s: operation %q: %s", filename, name, err)
+				}
+				op.Test |= bits32(v)
+				op.Mask |= bits32(mask)
+				op.Ignore |= bits32(ignore)
+				continue
+			}
+			argName := raw
+			if alias, ok := upstreamArgAliases[raw]; ok {
+				argName = alias
+			}
+			if argName == "" {
+				continue
+			}
+			operands = append(operands, argName)
+		}
+
+		// Upstream doesn't list the operands in assembly order, and lists
+		// split immediates once per piece, so we compare them to the codec
+		// operands as sets.
+		want := operandSetKey(operands)
+		for _, codecName := range codecNames {
+			codec := codecs[codecName]
+			if operandSetKey(codec.Operands) == want {
+				op.Codec = codec
+				break
+			}
+		}
+		if op.Codec == nil {
+			warnSpec("%s: no codec has the operands of %q (%s)", filename, name, strings.Join(operands, " "))
+			continue
+		}
+
+		if (op.Mask & 0b1111111) == 0b1111111 {
+			op.MajorOpcode = majors[bits8(op.Test&0b1111111)]
+		}
+
+		for _, std := range stds {
+			op.Standards.Add(std)
+			op.Standards.Add(std.Base())
+		}
+		if op.MajorOpcode == nil && op.Mask&0b1111111 == 0b1111111 && op.WidthBytes() == 4 {
+			warnMissingMajorOpcode(filename, &op, bits8(op.Test&0b1111111))
+		}
+
+		ret = append(ret, op)
+	}
+
+	return ret, sc.Err()
+}
+
+func operandSetKey(names []string) string {
+	set := make(map[string]struct{})
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	ret := make([]string, 0, len(set))
+	for name := range set {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, " ")
+}
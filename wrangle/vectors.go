@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+)
+
+// testVector is an instruction word along with the operation it should
+// decode to under a particular base ISA size.
+type testVector struct {
+	Size Size
+	Op   *Operation
+	Word bits32
+}
+
+// testVectorJSON is the JSON representation of a testVector, which also
+// includes the operand values that a decoder should extract from the word.
+type testVectorJSON struct {
+	Base     string           `json:"base"`
+	Name     string           `json:"name"`
+	Word     string           `json:"word"`
+	Operands map[string]int64 `json:"operands"`
+}
+
+// vectorPatterns are the raw operand values we'll try for each operation,
+// in addition to the canonical encoding where all of the operands are zero.
+// Each is truncated to fit the operand it's assigned to, and chosen to be
+// easy to recognize in decoder output.
+var vectorPatterns = []int64{
+	1,
+	-1,
+	0x55555555,
+	0x2aaaaaaa,
+}
+
+// buildTestVectors returns a set of instruction words for each operation
+// in the RV32 and RV64 base ISAs, each of which unambiguously decodes to
+// that operation.
+func buildTestVectors(isa *ISA) []testVector {
+	var vectors []testVector
+
+	for _, size := range []Size{RV32, RV64} {
+		anyStd := size.Any()
+		for i := range isa.Ops {
+			op := &isa.Ops[i]
+			if !op.Standards.Has(anyStd) {
+				continue
+			}
+
+			candidates := []bits32{op.Test}
+			for _, pattern := range vectorPatterns {
+				word := op.Test
+				for _, argName := range op.Codec.Operands {
+					arg := isa.Argument(argName, size)
+					word |= arg.Encode(pattern) &^ op.Mask
+				}
+				candidates = append(candidates, word)
+			}
+
+			seen := make(map[bits32]struct{})
+			for _, word := range candidates {
+				if _, ok := seen[word]; ok {
+					continue
+				}
+				seen[word] = struct{}{}
+
+				// Operand values can sometimes produce an encoding that
+				// belongs to a more specific operation, so we'll include
+				// only the words that unambiguously decode back to the
+				// operation we started with.
+				if got := isa.Decode(word, size); got != op {
+					if *verbose {
+						log.Printf("skipping %s vector %s for %s: does not decode unambiguously", size.Any(), word, op.Name)
+					}
+					continue
+				}
+
+				vectors = append(vectors, testVector{
+					Size: size,
+					Op:   op,
+					Word: word,
+				})
+			}
+		}
+	}
+
+	return vectors
+}
+
+func generateTestVectors(w io.Writer, isa *ISA) error {
+	vectors := buildTestVectors(isa)
+	ret := make([]testVectorJSON, len(vectors))
+	for i, vec := range vectors {
+		ret[i] = testVectorJSON{
+			Base:     vec.Size.Any().String(),
+			Name:     vec.Op.Name,
+			Word:     fmt.Sprintf("0x%08x", uint32(vec.Word)),
+			Operands: make(map[string]int64),
+		}
+		for _, argName := range vec.Op.Codec.Operands {
+			arg := isa.Argument(argName, vec.Size)
+			ret[i].Operands[arg.Name] = arg.Decode(vec.Word)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ret)
+}
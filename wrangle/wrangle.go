@@ -1,17 +1,296 @@
 package main
 
 import (
+	"flag"
+	"io"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/davecgh/go-spew/spew"
 )
 
+var verbose = flag.Bool("v", false, "log details about spec entries skipped while loading")
+
+var strict = flag.Bool("strict", false, "fail if the spec has any anomalies, rather than skipping them")
+
+var regNames = flag.String("regnames", "abi", "register naming style for output: abi or numeric")
+
+var mnemonics = flag.String("mnemonics", "dotted", "style for mnemonics in disassembly and generated string tables: dotted, underscore, or joined")
+
+var rustNames = flag.String("rust-names", "pascal", "naming style for generated Rust enum variants: pascal or snake")
+
+var extensions = flag.String("extensions", "", "extension letters to include, such as IMAC, optionally after a base ISA size as in rv32imac (default all)")
+
+var noImplicitBase = flag.Bool("no-implicit-base", false, "don't implicitly include the base integer extension I when filtering extensions")
+
+var noCompressed = flag.Bool("no-compressed", false, "exclude the operations of the C extension, and the compressed decoder, so that all instructions are 32 bits")
+
+var excludeDrafts = flag.Bool("exclude-drafts", false, "exclude operations from extensions whose status is draft")
+
+var hints = flag.Bool("hints", false, "generate predicates for detecting HINT encodings")
+
+var encodingDocs = flag.Bool("encoding-docs", false, "include each operation's encoding in the doc comments of the generated Rust enums")
+
+var rustDerives = flag.String("derives", "Debug,Clone,Copy,PartialEq,Eq", "comma-separated traits to derive for the generated Rust types")
+
+var serde = flag.Bool("serde", false, "derive serde's Serialize and Deserialize for the generated Rust types")
+
+var sharedOperands = flag.Bool("shared-operands", false, "extract the operands of operations that share a codec using one helper function per codec in the generated Rust decoders")
+
+var indentStyle = flag.String("indent", "spaces", "indentation style for generated Rust and C++: spaces or tabs")
+
+var indentWidth = flag.Int("indent-width", 4, "number of spaces per level of indentation when -indent=spaces")
+
+var testDiscriminants = flag.Bool("test-discriminants", false, "give the variants of the generated Rust operation enums explicit discriminants equal to their encoding templates")
+
+var constFns = flag.Bool("const", false, "declare the generated Rust accessors that are pure bit arithmetic as const fn, for use in const contexts")
+
+var singleFile = flag.Bool("single-file", false, "generate all of the Rust code into a single riscv.rs module")
+
+var splitBy = flag.String("split-by", "", "split the generated Rust operation enums into one file per extension, with -split-by=extension")
+
+var headerFile = flag.String("header", "", "file whose text, such as a license, to include in a comment at the top of each generated file")
+
+var revision = flag.String("revision", "", "source revision of the spec to mention in the header of each generated file")
+
+var outputPath = flag.String("o", "", "file to write the output of reports and dumps to, instead of stdout")
+
+var profile = flag.Bool("profile", false, "report how long each load step and generator takes on stderr")
+
+var backends = flag.String("backends", "rust,go,cpp", "comma-separated code generators to run, each writing into a subdirectory of generated")
+
+var upstream = flag.String("upstream", "", "load operations from a riscv-opcodes checkout instead of the opcodes file")
+
+var opcodesFile = flag.String("opcodes", "", "operations file to load in place of the opcodes file, or - for stdin")
+
+var overlays stringList
+
+var mergeOpcodes stringList
+
+func init() {
+	flag.Var(&overlays, "overlay", "directory of additional spec files to merge into the base ISA (may be repeated)")
+	flag.Var(&mergeOpcodes, "merge-opcodes", "operations file to merge over the base ISA's operations, or - for stdin (may be repeated)")
+}
+
+// stringList is a flag.Value that collects the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
 func main() {
-	isa, err := loadISAMeta()
+	flag.Parse()
+	if *regNames != "abi" && *regNames != "numeric" {
+		log.Fatalf("invalid -regnames %q: must be abi or numeric", *regNames)
+	}
+
+	style, err := ParseNameStyle(*rustNames)
+	if err != nil {
+		log.Fatalf("invalid -rust-names: %s", err)
+	}
+
+	mnemonicStyle, err = ParseMnemonicStyle(*mnemonics)
+	if err != nil {
+		log.Fatalf("invalid -mnemonics: %s", err)
+	}
+
+	indentUnit, err = parseIndentUnit(*indentStyle, *indentWidth)
+	if err != nil {
+		log.Fatalf("invalid -indent: %s", err)
+	}
+
+	switch {
+	case *splitBy != "" && *splitBy != "extension":
+		log.Fatalf("invalid -split-by %q: must be extension", *splitBy)
+	case *splitBy != "" && *singleFile:
+		log.Fatal("-split-by cannot be combined with -single-file")
+	}
+
+	backendList, err := parseBackends(*backends)
+	if err != nil {
+		log.Fatalf("invalid -backends: %s", err)
+	}
+
+	opts := loadOptions{
+		Overlays:     overlays,
+		UpstreamDir:  *upstream,
+		OpcodesFile:  *opcodesFile,
+		MergeOpcodes: mergeOpcodes,
+	}
+	if err := loadFileHeader(opts); err != nil {
+		log.Fatalf("invalid -header: %s", err)
+	}
+
+	isa, err := loadISAMeta(opts)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *strict && len(specWarnings) != 0 {
+		log.Fatalf("found %d anomalies in the spec", len(specWarnings))
+	}
+	filterExtensions(isa, *extensions)
+	if *excludeDrafts {
+		isa.ExcludeDrafts()
+	}
+	if *noCompressed {
+		isa.ExcludeCompressed()
+	}
 
-	spew.Dump(isa)
-	generateRustFragments("generated/rust", isa)
+	// Reports and dumps go to stdout unless -o is set, in which case the
+	// file is created only once we know the command produces a report.
+	var outFile *outputFile
+	out := func() io.Writer {
+		if *outputPath == "" {
+			return os.Stdout
+		}
+		f, err := createOutputFile(*outputPath)
+		if err != nil {
+			log.Fatalf("invalid -o: %s", err)
+		}
+		outFile = f
+		return f
+	}
+
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+		spew.Dump(isa)
+		err = runBackends("generated", backendList, isa, style)
+	case "stats":
+		err = printStats(out(), isa)
+	case "gen-vectors":
+		err = generateTestVectors(out(), isa)
+	case "encoding-index":
+		err = generateEncodingIndex(out(), isa)
+	case "check":
+		err = printSpecProblems(out(), isa)
+	case "roundtrip":
+		err = printRoundtripProblems(out(), isa)
+	case "diagrams":
+		fs := flag.NewFlagSet("diagrams", flag.ExitOnError)
+		format := fs.String("diagram", "ascii", "diagram format: ascii or svg")
+		fs.Parse(flag.Args()[1:])
+		dir := "generated/diagrams"
+		if fs.NArg() > 0 {
+			dir = fs.Arg(0)
+		}
+		err = generateEncodingDiagrams(dir, isa, *format)
+	case "decode-tree":
+		filename := "generated/decode-tree.dot"
+		if flag.NArg() > 1 {
+			filename = flag.Arg(1)
+		}
+		err = generateDecodeTreeDot(filename, isa)
+	case "kaitai":
+		filename := "generated/riscv.ksy"
+		if flag.NArg() > 1 {
+			filename = flag.Arg(1)
+		}
+		err = generateKaitaiStruct(filename, isa)
+	case "decode-table":
+		filename := "generated/decode-table.bin"
+		if flag.NArg() > 1 {
+			filename = flag.Arg(1)
+		}
+		err = generateBinaryTable(filename, isa)
+	case "rust-macro":
+		filename := "generated/rust_ops.rs"
+		if flag.NArg() > 1 {
+			filename = flag.Arg(1)
+		}
+		err = generateRustMacroInput(filename, isa, style)
+	case "list":
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		long := fs.Bool("long", false, "include the full name and standards of each operation")
+		exts := fs.String("extensions", "", "extension letters to include, such as IMAC, optionally after a base ISA size as in rv32imac (default all)")
+		fs.Parse(flag.Args()[1:])
+		filterExtensions(isa, *exts)
+		err = printOperationList(out(), isa, *long)
+	case "dump-ops":
+		fs := flag.NewFlagSet("dump-ops", flag.ExitOnError)
+		exts := fs.String("extensions", "", "extension letters to include, such as IMAC, optionally after a base ISA size as in rv32imac (default all)")
+		fs.Parse(flag.Args()[1:])
+		filterExtensions(isa, *exts)
+		err = printOperationTable(out(), isa)
+	case "disasm":
+		fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+		raw := fs.Bool("raw", false, "treat the file as a flat binary of instructions rather than as an ELF file")
+		base := fs.String("base", "0", "address of the start of a flat binary, with -raw")
+		xlen := fs.Int("xlen", 64, "base ISA width of a flat binary, 32 or 64, with -raw")
+		fs.Parse(flag.Args()[1:])
+		if fs.NArg() != 1 {
+			log.Fatal("usage: wrangle disasm [-raw [-base ADDR] [-xlen 32|64]] <file>")
+		}
+		if !*raw {
+			err = disassembleELF(out(), isa, fs.Arg(0))
+			break
+		}
+		addr, parseErr := strconv.ParseUint(*base, 0, 64)
+		if parseErr != nil {
+			log.Fatalf("invalid -base: %s", parseErr)
+		}
+		var size Size
+		switch *xlen {
+		case 32:
+			size = RV32
+		case 64:
+			size = RV64
+		default:
+			log.Fatalf("invalid -xlen %d: must be 32 or 64", *xlen)
+		}
+		err = disassembleFlat(out(), isa, fs.Arg(0), addr, size)
+	case "repl":
+		err = runREPL(os.Stdin, os.Stdout, isa)
+	case "imm-report":
+		fs := flag.NewFlagSet("imm-report", flag.ExitOnError)
+		rawValue := fs.String("value", "", "immediate value to encode in the example (default a pattern of alternating bits)")
+		fs.Parse(flag.Args()[1:])
+		if fs.NArg() != 1 {
+			log.Fatal("usage: wrangle imm-report [-value N] <operation>")
+		}
+		var value *int64
+		if *rawValue != "" {
+			v, err := strconv.ParseInt(*rawValue, 0, 64)
+			if err != nil {
+				log.Fatalf("invalid -value: %s", err)
+			}
+			value = &v
+		}
+		err = printImmediateReport(out(), isa, fs.Arg(0), value)
+	default:
+		log.Fatalf("unknown command %q", cmd)
+	}
+	if outFile != nil {
+		if closeErr := outFile.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// filterExtensions applies an extension filter given on the command line,
+// if any, for the base ISA size it names, if any. Every other extension
+// builds on the base integer extension, so it's included even if not
+// listed unless -no-implicit-base is set.
+func filterExtensions(isa *ISA, raw string) {
+	if raw == "" {
+		return
+	}
+	size, exts, err := ParseExtensions(raw)
+	if err != nil {
+		log.Fatalf("invalid -extensions: %s", err)
+	}
+	if !*noImplicitBase {
+		exts = append(exts, ExtI)
+	}
+	isa.FilterExtensions(size, exts)
 }